@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/shellkjell/gofigure"
+)
+
+var stderr = log.New(os.Stderr, "", 0)
+
+func check(e error) {
+	if e != nil {
+		stderr.Println(e)
+		os.Exit(1)
+	}
+}
+
+var outFile string
+var inFiles stringList
+var includePaths stringList
+var overrides stringList
+var defines = defineMap{}
+var maxErrors int
+var maxIncludeDepth int
+var noEnv bool
+var omitEmpty bool
+var profile string
+var profileShared bool
+var schemaFile string
+var sortKeys bool
+
+// stringList - A flag that can be given several times
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+
+	return nil
+}
+
+// defineMap - A flag defining a variable as name=value, or as name to set it to "true"
+type defineMap map[string]string
+
+func (d defineMap) String() string {
+	list := []string{}
+
+	for name, value := range d {
+		list = append(list, name+"="+value)
+	}
+
+	sort.Strings(list)
+
+	return strings.Join(list, ",")
+}
+
+func (d defineMap) Set(define string) error {
+	name, value := define, "true"
+
+	if i := strings.IndexByte(define, '='); i >= 0 {
+		name, value = define[:i], define[i+1:]
+	}
+
+	d[name] = value
+
+	return nil
+}
+
+func init() {
+	flag.StringVar(&outFile, "o", "", "Output filename, - or none for the standard output")
+	flag.Var(&inFiles, "i", "Input filename, - for the standard input, can be given several times to layer files with later ones overriding earlier ones")
+	flag.Var(defines, "D", "Variable for %if conditions, as name=value, can be given several times")
+	flag.Var(&includePaths, "I", "Directory to search for included files, can be given several times")
+	flag.Var(&overrides, "set", "Key path to set after every file, as path=value with the value written as in .fig or as a plain string, can be given several times")
+	flag.IntVar(&maxErrors, "max-errors", gofigure.DefaultMaxErrors, "Maximum number of errors to report, 0 for no limit")
+	flag.IntVar(&maxIncludeDepth, "max-include-depth", gofigure.DefaultMaxIncludeDepth, "Maximum number of files includes may nest, 0 for no limit")
+	flag.BoolVar(&noEnv, "no-env", false, "Ignore environment variables, so environment values take their defaults")
+	flag.StringVar(&profile, "profile", "", "Top level map to output as the whole configuration, also the variable profile of %if conditions")
+	flag.BoolVar(&profileShared, "profile-shared", false, "Merge the top level keys that aren't maps into the selected profile")
+	flag.BoolVar(&omitEmpty, "omit-empty", false, "Leave out keys that are null, empty maps or empty arrays")
+	flag.BoolVar(&sortKeys, "sort", false, "Sort keys alphabetically instead of keeping the order they were defined in")
+	flag.StringVar(&schemaFile, "schema", "", "JSON schema, as generated by gofigure.SchemaOf, to check for unknown and missing keys")
+}
+
+func usage() {
+	fmt.Println("usage: " + os.Args[0] + " -i inFile [-i inFile ...] [-o outFile]")
+	fmt.Println("       " + os.Args[0] + " explain -i inFile [-i inFile ...] key.path")
+	flag.PrintDefaults()
+	os.Exit(1)
+}
+
+func main() {
+	args := os.Args[1:]
+
+	// "explain" prints where a key was defined instead of the configuration
+	explain := len(args) > 0 && args[0] == "explain"
+	if explain {
+		args = args[1:]
+	}
+
+	flag.CommandLine.Parse(args)
+
+	if len(inFiles) == 0 {
+		stderr.Println("Need a file to parse")
+		usage()
+	}
+
+	if explain && flag.NArg() != 1 {
+		stderr.Println("Need a key path to explain")
+		usage()
+	}
+
+	loader := &gofigure.Loader{
+		Defines:         defines,
+		DisableEnv:      noEnv,
+		IncludePaths:    includePaths,
+		MaxErrors:       maxErrors,
+		MaxIncludeDepth: maxIncludeDepth,
+		OmitEmpty:       omitEmpty,
+		Overrides:       overrides,
+		Profile:         profile,
+		ProfileShared:   profileShared,
+		SortKeys:        sortKeys,
+	}
+
+	config, err := loader.LoadFiles(inFiles...)
+
+	check(err)
+
+	if schemaFile != "" {
+		schemaJSON, err := ioutil.ReadFile(schemaFile)
+
+		check(err)
+
+		schema := &gofigure.Schema{}
+
+		check(json.Unmarshal(schemaJSON, schema))
+		check(schema.Check(config))
+	}
+
+	if explain {
+		explainKey(config, flag.Arg(0))
+		return
+	}
+
+	marshaled, err := json.Marshal(config)
+
+	check(err)
+
+	if outFile == "" || outFile == "-" {
+		fmt.Println(string(marshaled))
+	} else {
+		check(ioutil.WriteFile(outFile, marshaled, 0644))
+	}
+}
+
+// explainKey - Prints the value of the key at path and every place that defined or overrode it
+func explainKey(config *gofigure.Config, path string) {
+	value, err := config.Lookup(path)
+
+	check(err)
+
+	origins, err := config.Explain(path)
+
+	check(err)
+
+	marshaled, err := json.Marshal(value)
+
+	check(err)
+
+	fmt.Println(path + " = " + string(marshaled))
+
+	for i, origin := range origins {
+		if i == 0 {
+			fmt.Println("  defined at " + origin.String())
+		} else {
+			fmt.Println("  overridden at " + origin.String())
+		}
+	}
+}
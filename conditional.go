@@ -0,0 +1,114 @@
+package gofigure
+
+import (
+	"errors"
+)
+
+// holds - Reports whether the condition holds for the defined variables. A variable that isn't
+// defined equals no value, and on its own a variable holds unless it's empty or "false"
+func (c *Condition) holds(defines map[string]string) bool {
+	value, defined := defines[c.Name]
+
+	switch c.Operator {
+	case "==":
+		return defined && value == *c.Value
+	case "!=":
+		return !defined || value != *c.Value
+	}
+
+	return defined && value != "" && value != "false"
+}
+
+// branch - Returns the entries of the first branch whose condition holds, if any
+func (c *Conditional) branch(defines map[string]string) []*Entry {
+	if c.Condition.holds(defines) {
+		return c.Then
+	}
+
+	if c.ElseIf != nil {
+		return c.ElseIf.branch(defines)
+	}
+
+	return c.Else
+}
+
+// resolveConditionals - Replaces the conditionals among entries with the entries of the branches
+// that are taken, before anything else looks at them, so the other branches are never used
+func (l *load) resolveConditionals(entries []*Entry) (ret []*Entry) {
+	ret = make([]*Entry, 0, len(entries))
+
+	for _, entry := range entries {
+		switch {
+		case entry.Conditional != nil:
+			ret = append(ret, l.resolveConditionals(entry.Conditional.branch(l.defines))...)
+			continue
+		case entry.Section != nil:
+			entry.Section.Fields = l.resolveConditionalFields(entry.Section.Fields)
+		case entry.Field != nil:
+			l.resolveConditionalsInField(entry.Field)
+		case entry.Include != nil:
+			entry.Include.Params = l.resolveConditionalFields(entry.Include.Params)
+		}
+
+		ret = append(ret, entry)
+	}
+
+	return
+}
+
+// resolveConditionalFields - Replaces the conditionals in a section or map with the fields of the
+// branches that are taken
+func (l *load) resolveConditionalFields(fields []*Field) (ret []*Field) {
+	if fields == nil {
+		return nil
+	}
+
+	ret = make([]*Field, 0, len(fields))
+
+	for _, field := range fields {
+		if field.Conditional == nil {
+			l.resolveConditionalsInField(field)
+			ret = append(ret, field)
+			continue
+		}
+
+		for _, entry := range l.resolveConditionals(field.Conditional.branch(l.defines)) {
+			switch {
+			case entry.Field != nil:
+				ret = append(ret, entry.Field)
+			case entry.Include != nil:
+				ret = append(ret, &Field{Include: entry.Include, Pos: entry.Pos})
+			default:
+				l.errs.add(checkConfigError(SyntaxError, errors.New("Sections are only allowed in conditionals at the top level"), entry, ""))
+			}
+		}
+	}
+
+	return
+}
+
+func (l *load) resolveConditionalsInField(f *Field) {
+	if f.Include != nil {
+		f.Include.Params = l.resolveConditionalFields(f.Include.Params)
+	}
+
+	for child := f.Child; child != nil; child = child.Child {
+		if child.Value != nil {
+			l.resolveConditionalsInValue(child.Value)
+		}
+	}
+
+	if f.Value != nil {
+		l.resolveConditionalsInValue(f.Value)
+	}
+}
+
+func (l *load) resolveConditionalsInValue(v *Value) {
+	v.Map = l.resolveConditionalFields(v.Map)
+
+	for _, value := range v.ParsedArray {
+		if value != nil {
+			l.resolveConditionalsInValue(value)
+		}
+	}
+}
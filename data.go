@@ -0,0 +1,476 @@
+package gofigure
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/alecthomas/participle/lexer"
+	"gopkg.in/yaml.v3"
+)
+
+// DataDecoder - Decodes a data file in a foreign format, such as INI or HCL, for an include.
+// Maps are returned as *OrderedMap, to keep their key order, or as maps with string keys,
+// arrays as slices and scalars as strings, booleans, integers, floats, nil or values
+// implementing encoding.TextMarshaler. Keys included through a DataDecoder are positioned
+// at the file they're in, without a line
+type DataDecoder func(data []byte) (interface{}, error)
+
+// builtinDataFormats - The data formats that can always be included, unless DataFormats replaces them
+var builtinDataFormats = map[string]DataDecoder{
+	"json": decodeJSON,
+	"yaml": decodeYAML,
+	"toml": decodeTOML,
+}
+
+// dataFormat - Returns the data format of an include of the file at the resolved path: the
+// format named in the include, or else the one matching the extension of the file. Files of
+// no data format are .fig files
+func (l *Loader) dataFormat(include *Include, resolved string) (string, error) {
+	if include.Format != "" {
+		format := normalizeDataFormat(include.Format)
+
+		if l.dataDecoder(format) == nil {
+			return "", errors.New("No decoder for the data format \"" + include.Format + "\"")
+		}
+
+		return format, nil
+	}
+
+	format := normalizeDataFormat(strings.TrimPrefix(filepath.Ext(resolved), "."))
+
+	if l.dataDecoder(format) != nil {
+		return format, nil
+	}
+
+	return "", nil
+}
+
+// normalizeDataFormat - Returns the name of a data format in lower case, with yml as yaml, so
+// names in includes and extensions of files match the names of decoders alike
+func normalizeDataFormat(format string) string {
+	format = strings.ToLower(format)
+
+	if format == "yml" {
+		return "yaml"
+	}
+
+	return format
+}
+
+// dataDecoder - Returns the decoder of a data format, from DataFormats or else the built in ones
+func (l *Loader) dataDecoder(format string) DataDecoder {
+	if decoder, exists := l.DataFormats[format]; exists {
+		return decoder
+	}
+
+	return builtinDataFormats[format]
+}
+
+func (l *Loader) decodeData(format string, data []byte) (interface{}, error) {
+	return l.dataDecoder(format)(data)
+}
+
+// decodeJSON - Decodes a JSON document, keeping the key order of its objects and where their
+// keys are
+func decodeJSON(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	value, err := decodeJSONValue(decoder, data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("Unexpected data after the JSON document")
+	}
+
+	return value, nil
+}
+
+func decodeJSONValue(decoder *json.Decoder, data []byte) (interface{}, error) {
+	token, err := decoder.Token()
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		object := NewOrderedMap()
+
+		for decoder.More() {
+			// Only white space and commas are left between the previous token and the key
+			offset := int(decoder.InputOffset())
+			offset += bytes.IndexByte(data[offset:], '"')
+
+			key, err := decoder.Token()
+
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := decodeJSONValue(decoder, data)
+
+			if err != nil {
+				return nil, err
+			}
+
+			object.define(key.(string), value, []Origin{{Pos: offsetPosition(data, offset)}})
+		}
+
+		_, err = decoder.Token()
+
+		return object, err
+
+	case json.Delim('['):
+		array := []interface{}{}
+
+		for decoder.More() {
+			value, err := decodeJSONValue(decoder, data)
+
+			if err != nil {
+				return nil, err
+			}
+
+			array = append(array, value)
+		}
+
+		_, err = decoder.Token()
+
+		return array, err
+	}
+
+	if number, isNumber := token.(json.Number); isNumber {
+		if integer, err := number.Int64(); err == nil {
+			return integer, nil
+		}
+
+		return number.Float64()
+	}
+
+	return token, nil
+}
+
+// offsetPosition - Returns the line and column of the byte at offset in data
+func offsetPosition(data []byte, offset int) lexer.Position {
+	lineStart := bytes.LastIndexByte(data[:offset], '\n') + 1
+
+	return lexer.Position{
+		Line:   bytes.Count(data[:offset], []byte{'\n'}) + 1,
+		Column: offset - lineStart + 1,
+	}
+}
+
+// decodeYAML - Decodes a YAML document, keeping the key order of its maps and where their keys
+// are. Aliases are replaced by what they refer to, and merge keys as in <<: *defaults bring in
+// the keys of the merged maps that the map doesn't set itself
+func decodeYAML(data []byte) (interface{}, error) {
+	var document yaml.Node
+
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+
+	if len(document.Content) == 0 {
+		return nil, nil
+	}
+
+	return decodeYAMLNode(document.Content[0])
+}
+
+func decodeYAMLNode(node *yaml.Node) (interface{}, error) {
+	switch node.Kind {
+	case yaml.AliasNode:
+		return decodeYAMLNode(node.Alias)
+
+	case yaml.MappingNode:
+		object := NewOrderedMap()
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			value, err := decodeYAMLNode(node.Content[i+1])
+
+			if err != nil {
+				return nil, err
+			}
+
+			if key.ShortTag() != "!!merge" {
+				object.define(key.Value, value, []Origin{{Pos: lexer.Position{Line: key.Line, Column: key.Column}}})
+				continue
+			}
+
+			merged, isList := value.([]interface{})
+
+			if !isList {
+				merged = []interface{}{value}
+			}
+
+			for _, mergedValue := range merged {
+				mergedMap, isMap := mergedValue.(*OrderedMap)
+
+				if !isMap {
+					return nil, errors.New("Only maps can be merged with <<")
+				}
+
+				for _, mergedKey := range mergedMap.keys {
+					if _, exists := object.Get(mergedKey); !exists {
+						object.define(mergedKey, mergedMap.values[mergedKey], mergedMap.origins[mergedKey])
+					}
+				}
+			}
+		}
+
+		return object, nil
+
+	case yaml.SequenceNode:
+		array := []interface{}{}
+
+		for _, element := range node.Content {
+			value, err := decodeYAMLNode(element)
+
+			if err != nil {
+				return nil, err
+			}
+
+			array = append(array, value)
+		}
+
+		return array, nil
+	}
+
+	var value interface{}
+	err := node.Decode(&value)
+
+	return value, err
+}
+
+// decodeTOML - Decodes a TOML document, keeping the order its keys are defined in. The decoder
+// doesn't tell where keys are, so they're positioned at the file only
+func decodeTOML(data []byte) (interface{}, error) {
+	var document map[string]interface{}
+
+	metadata, err := toml.Decode(string(data), &document)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Keys of tables in arrays of tables share a path, which is all the order needs
+	order := map[string]int{}
+
+	for i, key := range metadata.Keys() {
+		path := strings.Join(key, ".")
+
+		if _, exists := order[path]; !exists {
+			order[path] = i
+		}
+	}
+
+	return orderTOMLValue(document, "", order), nil
+}
+
+func orderTOMLValue(data interface{}, path string, order map[string]int) interface{} {
+	switch data := data.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(data))
+
+		for key := range data {
+			keys = append(keys, key)
+		}
+
+		sort.Slice(keys, func(i, j int) bool {
+			return order[joinPath(path, keys[i])] < order[joinPath(path, keys[j])]
+		})
+
+		object := NewOrderedMap()
+
+		for _, key := range keys {
+			object.Set(key, orderTOMLValue(data[key], joinPath(path, key), order))
+		}
+
+		return object
+
+	case []map[string]interface{}:
+		array := make([]interface{}, len(data))
+
+		for i, element := range data {
+			array[i] = orderTOMLValue(element, path, order)
+		}
+
+		return array
+
+	case []interface{}:
+		array := make([]interface{}, len(data))
+
+		for i, element := range data {
+			array[i] = orderTOMLValue(element, path, order)
+		}
+
+		return array
+	}
+
+	return data
+}
+
+// dataToEntries - Turns a decoded data document into entries, as if it had been written in .fig
+func dataToEntries(data interface{}, pos lexer.Position) ([]*Entry, error) {
+	value, err := dataToValue(data, pos)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// A value with nothing set is an empty map
+	if value == nil || value.String != nil || value.Integer != nil || value.Float != nil || value.Boolean != nil || value.ParsedArray != nil {
+		return nil, errors.New("Included data has to be a map")
+	}
+
+	entries := make([]*Entry, len(value.Map))
+
+	for i, field := range value.Map {
+		entries[i] = &Entry{Field: field, Pos: pos}
+	}
+
+	return entries, nil
+}
+
+func dataToValue(data interface{}, pos lexer.Position) (*Value, error) {
+	if data == nil {
+		return nil, nil
+	}
+
+	value := &Value{Pos: pos}
+
+	if dataMap, isMap := data.(*OrderedMap); isMap {
+		value.HasMap = true
+
+		for _, key := range dataMap.keys {
+			// Decoders that know where keys are record it as their origin
+			keyPos := pos
+
+			if origins := dataMap.origins[key]; len(origins) > 0 {
+				keyPos.Line, keyPos.Column = origins[0].Pos.Line, origins[0].Pos.Column
+			}
+
+			field, err := dataToField(key, dataMap.values[key], keyPos)
+
+			if err != nil {
+				return nil, err
+			}
+
+			value.Map = append(value.Map, field)
+		}
+
+		return value, nil
+	}
+
+	if marshaler, isMarshaler := data.(encoding.TextMarshaler); isMarshaler {
+		text, err := marshaler.MarshalText()
+
+		if err != nil {
+			return nil, err
+		}
+
+		str := string(text)
+		value.String, value.literal = &str, true
+
+		return value, nil
+	}
+
+	rv := reflect.ValueOf(data)
+
+	switch rv.Kind() {
+	case reflect.String:
+		str := rv.String()
+		value.String, value.literal = &str, true
+
+	case reflect.Bool:
+		boolean := Bool(rv.Bool())
+		value.Boolean = &boolean
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		integer := rv.Int()
+		value.Integer = &integer
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() > math.MaxInt64 {
+			return nil, errors.New("Included integer is too large")
+		}
+
+		integer := int64(rv.Uint())
+		value.Integer = &integer
+
+	case reflect.Float32, reflect.Float64:
+		float := rv.Float()
+		value.Float = &float
+
+	case reflect.Slice, reflect.Array:
+		value.HasArray = true
+		value.ParsedArray = make([]*Value, rv.Len())
+
+		for i := 0; i < rv.Len(); i++ {
+			element, err := dataToValue(rv.Index(i).Interface(), pos)
+
+			if err != nil {
+				return nil, err
+			}
+
+			value.ParsedArray[i] = element
+		}
+
+	case reflect.Map:
+		value.HasMap = true
+		keys := make([]string, 0, rv.Len())
+		values := map[string]interface{}{}
+
+		for _, key := range rv.MapKeys() {
+			keyString, isString := key.Interface().(string)
+
+			if !isString {
+				return nil, errors.New("Included maps have to have string keys")
+			}
+
+			keys = append(keys, keyString)
+			values[keyString] = rv.MapIndex(key).Interface()
+		}
+
+		// Plain maps have no order, so their keys are sorted to make includes deterministic
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			field, err := dataToField(key, values[key], pos)
+
+			if err != nil {
+				return nil, err
+			}
+
+			value.Map = append(value.Map, field)
+		}
+
+	default:
+		return nil, errors.New("Cannot include a value of type " + rv.Type().String())
+	}
+
+	return value, nil
+}
+
+func dataToField(key string, data interface{}, pos lexer.Position) (*Field, error) {
+	value, err := dataToValue(data, pos)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Field{Key: key, Value: value, Pos: pos}, nil
+}
@@ -0,0 +1,483 @@
+package gofigure
+
+import (
+	"encoding"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/participle/lexer"
+)
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Decoder - Decodes a transformed configuration into Go values
+type Decoder struct {
+	// Strict makes Decode also report keys that no struct field consumes and required
+	// fields without a value, as checked by the Schema of the decoded type
+	Strict bool
+
+	config *Config
+
+	errs *errorCollector
+}
+
+// NewDecoder - Returns a Decoder reading from config
+func NewDecoder(config *Config) *Decoder {
+	return &Decoder{config: config}
+}
+
+// Decode - Decodes config into the value pointed to by v, see Decoder.Decode
+func Decode(config *Config, v interface{}) error {
+	return NewDecoder(config).Decode(v)
+}
+
+// Decode - Decodes the configuration into the value pointed to by v.
+//
+// Maps are decoded into structs and maps with string keys, arrays into slices and arrays,
+// and scalars into the Go types they fit. Struct fields are matched by their `fig:"name"`
+// tag, or by their name ignoring case. A tag of "-" skips the field and the omitempty option,
+// as in `fig:"name,omitempty"`, leaves the field untouched when the value is null or empty.
+//
+// time.Duration fields take strings such as "1m30s" and types implementing
+// encoding.TextUnmarshaler take any scalar. Every value that can't be converted is reported
+// as a TypeConflict *ConfigError positioned at the value, collected in an ErrorList.
+//
+// When the Decoder is Strict, keys no field consumes are reported as UnknownKey errors and
+// fields tagged with the required option, as in `fig:"name,required"`, that have no value
+// are reported as MissingKey errors
+func (d *Decoder) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("Decode needs a non-nil pointer, got " + describeType(reflect.TypeOf(v)))
+	}
+
+	d.errs = &errorCollector{max: DefaultMaxErrors}
+
+	if d.Strict {
+		SchemaOf(v).check("", d.config.root, d.config.positions, lexer.Position{}, d.errs)
+	}
+
+	d.decodeValue("", d.config.root, rv.Elem(), lexer.Position{})
+
+	return d.errs.err()
+}
+
+func (d *Decoder) fail(path string, pos lexer.Position, message string) {
+	d.errs.add(newPositionedError(TypeConflict, path, pos, message))
+}
+
+func (d *Decoder) mismatch(path string, pos lexer.Position, src interface{}, dst reflect.Value) {
+	d.fail(path, pos, "Cannot decode "+describeValue(src)+" into "+describeType(dst.Type()))
+}
+
+func (d *Decoder) decodeValue(path string, src interface{}, dst reflect.Value, pos lexer.Position) {
+	if d.errs.full() {
+		return
+	}
+
+	// Use the position of the closest value that has one
+	if valuePos, exists := d.config.positions.lookup(src); exists {
+		pos = valuePos
+	}
+
+	src = plainScalar(src)
+
+	if src == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return
+	}
+
+	if dst.Kind() == reflect.Ptr {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+
+		d.decodeValue(path, src, dst.Elem(), pos)
+		return
+	}
+
+	if dst.CanAddr() && dst.Addr().Type().Implements(textUnmarshalerType) {
+		text, isScalar := scalarText(src)
+
+		if !isScalar {
+			d.mismatch(path, pos, src, dst)
+			return
+		}
+
+		if err := dst.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text)); err != nil {
+			d.fail(path, pos, err.Error())
+		}
+
+		return
+	}
+
+	if dst.Type() == durationType {
+		str, isString := src.(string)
+
+		if !isString {
+			d.mismatch(path, pos, src, dst)
+			return
+		}
+
+		duration, err := time.ParseDuration(str)
+
+		if err != nil {
+			d.fail(path, pos, err.Error())
+			return
+		}
+
+		dst.SetInt(int64(duration))
+		return
+	}
+
+	switch dst.Kind() {
+	case reflect.Interface:
+		if dst.NumMethod() != 0 {
+			d.mismatch(path, pos, src, dst)
+			return
+		}
+
+		dst.Set(reflect.ValueOf(plainTree(src)))
+
+	case reflect.String:
+		str, isString := src.(string)
+
+		if !isString {
+			d.mismatch(path, pos, src, dst)
+			return
+		}
+
+		dst.SetString(str)
+
+	case reflect.Bool:
+		boolean, isBool := src.(bool)
+
+		if !isBool {
+			d.mismatch(path, pos, src, dst)
+			return
+		}
+
+		dst.SetBool(boolean)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		integer, isInt := src.(int64)
+
+		if !isInt {
+			d.mismatch(path, pos, src, dst)
+			return
+		}
+
+		if dst.OverflowInt(integer) {
+			d.fail(path, pos, strconv.FormatInt(integer, 10)+" overflows "+describeType(dst.Type()))
+			return
+		}
+
+		dst.SetInt(integer)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		integer, isInt := src.(int64)
+
+		if !isInt {
+			d.mismatch(path, pos, src, dst)
+			return
+		}
+
+		if integer < 0 || dst.OverflowUint(uint64(integer)) {
+			d.fail(path, pos, strconv.FormatInt(integer, 10)+" overflows "+describeType(dst.Type()))
+			return
+		}
+
+		dst.SetUint(uint64(integer))
+
+	case reflect.Float32, reflect.Float64:
+		var float float64
+
+		switch src.(type) {
+		case float64:
+			float = src.(float64)
+		case int64:
+			float = float64(src.(int64))
+		default:
+			d.mismatch(path, pos, src, dst)
+			return
+		}
+
+		if dst.OverflowFloat(float) {
+			d.fail(path, pos, strconv.FormatFloat(float, 'g', -1, 64)+" overflows "+describeType(dst.Type()))
+			return
+		}
+
+		dst.SetFloat(float)
+
+	case reflect.Struct:
+		srcMap, isMap := src.(*OrderedMap)
+
+		if !isMap {
+			d.mismatch(path, pos, src, dst)
+			return
+		}
+
+		d.decodeStruct(path, srcMap, dst, pos)
+
+	case reflect.Map:
+		srcMap, isMap := src.(*OrderedMap)
+
+		if !isMap || dst.Type().Key().Kind() != reflect.String {
+			d.mismatch(path, pos, src, dst)
+			return
+		}
+
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMapWithSize(dst.Type(), srcMap.Len()))
+		}
+
+		for _, key := range srcMap.keys {
+			elem := reflect.New(dst.Type().Elem()).Elem()
+
+			d.decodeValue(joinPath(path, key), srcMap.values[key], elem, pos)
+
+			dst.SetMapIndex(reflect.ValueOf(key).Convert(dst.Type().Key()), elem)
+		}
+
+	case reflect.Slice:
+		srcList, isList := src.([]interface{})
+
+		if !isList {
+			d.mismatch(path, pos, src, dst)
+			return
+		}
+
+		list := reflect.MakeSlice(dst.Type(), len(srcList), len(srcList))
+
+		for i, value := range srcList {
+			d.decodeValue(joinPath(path, strconv.Itoa(i)), value, list.Index(i), pos)
+		}
+
+		dst.Set(list)
+
+	case reflect.Array:
+		srcList, isList := src.([]interface{})
+
+		if !isList {
+			d.mismatch(path, pos, src, dst)
+			return
+		}
+
+		if len(srcList) != dst.Len() {
+			d.fail(path, pos, "Cannot decode an array of "+strconv.Itoa(len(srcList))+" elements into "+describeType(dst.Type()))
+			return
+		}
+
+		for i, value := range srcList {
+			d.decodeValue(joinPath(path, strconv.Itoa(i)), value, dst.Index(i), pos)
+		}
+
+	default:
+		d.mismatch(path, pos, src, dst)
+	}
+}
+
+func (d *Decoder) decodeStruct(path string, src *OrderedMap, dst reflect.Value, pos lexer.Position) {
+	for _, field := range structFields(dst.Type()) {
+		key, exists := findKey(src, field.name)
+
+		if !exists {
+			continue
+		}
+
+		value := src.values[key]
+
+		if field.omitEmpty && isEmptyValue(value) {
+			continue
+		}
+
+		d.decodeValue(joinPath(path, key), value, dst.FieldByIndex(field.index), pos)
+	}
+}
+
+// structField - A struct field that can be decoded into, possibly of an embedded struct
+type structField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+	required  bool
+}
+
+func structFields(t reflect.Type) (fields []structField) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		tag := field.Tag.Get("fig")
+
+		if tag == "-" {
+			continue
+		}
+
+		tagParts := strings.Split(tag, ",")
+		name := tagParts[0]
+
+		// Fields of untagged embedded structs are decoded as if they were fields of the outer struct
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			for _, embedded := range structFields(field.Type) {
+				embedded.index = append([]int{i}, embedded.index...)
+				fields = append(fields, embedded)
+			}
+
+			continue
+		}
+
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		newField := structField{name: name, index: []int{i}}
+
+		for _, option := range tagParts[1:] {
+			switch option {
+			case "omitempty":
+				newField.omitEmpty = true
+			case "required":
+				newField.required = true
+			}
+		}
+
+		fields = append(fields, newField)
+	}
+
+	return
+}
+
+// findKey - Finds the key matching name in m, preferring an exact match over one ignoring case
+func findKey(m *OrderedMap, name string) (string, bool) {
+	if _, exists := m.values[name]; exists {
+		return name, true
+	}
+
+	for _, key := range m.keys {
+		if strings.EqualFold(key, name) {
+			return key, true
+		}
+	}
+
+	return "", false
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+// plainScalar - Dereferences the scalar pointers a transformed configuration holds
+func plainScalar(value interface{}) interface{} {
+	switch value.(type) {
+	case *string:
+		return *value.(*string)
+	case *int64:
+		return *value.(*int64)
+	case *float64:
+		return *value.(*float64)
+	case *Bool:
+		return bool(*value.(*Bool))
+	}
+
+	return value
+}
+
+// plainTree - Copies a transformed configuration value to plain maps with all scalar pointers dereferenced
+func plainTree(value interface{}) interface{} {
+	switch value.(type) {
+	case *OrderedMap:
+		plainMap := map[string]interface{}{}
+
+		for key, mapVal := range value.(*OrderedMap).values {
+			plainMap[key] = plainTree(mapVal)
+		}
+
+		return plainMap
+	case []interface{}:
+		plainList := make([]interface{}, len(value.([]interface{})))
+
+		for i, listVal := range value.([]interface{}) {
+			plainList[i] = plainTree(listVal)
+		}
+
+		return plainList
+	}
+
+	return plainScalar(value)
+}
+
+func scalarText(value interface{}) (string, bool) {
+	switch value.(type) {
+	case string:
+		return value.(string), true
+	case int64:
+		return strconv.FormatInt(value.(int64), 10), true
+	case float64:
+		return strconv.FormatFloat(value.(float64), 'g', -1, 64), true
+	case bool:
+		return strconv.FormatBool(value.(bool)), true
+	}
+
+	return "", false
+}
+
+func isEmptyValue(value interface{}) bool {
+	switch value := plainScalar(value).(type) {
+	case nil:
+		return true
+	case string:
+		return value == ""
+	case *OrderedMap:
+		return value.Len() == 0
+	case []interface{}:
+		return len(value) == 0
+	}
+
+	return false
+}
+
+func describeValue(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case int64:
+		return "integer"
+	case float64:
+		return "float"
+	case bool:
+		return "boolean"
+	case *OrderedMap:
+		return "map"
+	case []interface{}:
+		return "array"
+	}
+
+	return "value"
+}
+
+func describeType(t reflect.Type) string {
+	if t == nil {
+		return "nil"
+	}
+
+	return t.String()
+}
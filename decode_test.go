@@ -0,0 +1,127 @@
+package gofigure
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type decodeTestDatabase struct {
+	Host    string        `fig:"host"`
+	Port    uint16        `fig:"port"`
+	Timeout time.Duration `fig:"timeout"`
+	Address net.IP        `fig:"address"`
+}
+
+type decodeTestCommon struct {
+	Name string `fig:"name"`
+}
+
+type decodeTestConfig struct {
+	decodeTestCommon
+
+	Ratio     float64                       `fig:"ratio"`
+	Debug     *bool                         `fig:"debug"`
+	Tags      []string                      `fig:"tags"`
+	Pair      [2]int                        `fig:"pair"`
+	Databases map[string]decodeTestDatabase `fig:"databases"`
+	Primary   *decodeTestDatabase           `fig:"primary"`
+	Extra     interface{}                   `fig:"extra"`
+	Kept      string                        `fig:"kept,omitempty"`
+	Skipped   string                        `fig:"-"`
+	Untagged  int
+}
+
+func TestDecode(t *testing.T) {
+	config, err := Load(strings.NewReader(`
+	name: "service"
+	ratio: 2
+	debug: true
+	tags: ["a" "b"]
+	pair: [1 2]
+	kept
+	skipped: "value"
+	untagged: 7
+	extra: { list: [1 2.5 "three"] }
+
+	[databases.%{master,slave}]
+	host: "localhost"
+	port: 5432
+	timeout: "1m30s"
+	address: "10.0.0.1"
+
+	[]
+	primary: databases.master
+	`), "test.fig")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := decodeTestConfig{Kept: "default", Skipped: "default"}
+	if err := Decode(config, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	debug := true
+	database := decodeTestDatabase{
+		Host:    "localhost",
+		Port:    5432,
+		Timeout: 90 * time.Second,
+		Address: net.ParseIP("10.0.0.1"),
+	}
+
+	expected := decodeTestConfig{
+		decodeTestCommon: decodeTestCommon{Name: "service"},
+		Ratio:            2,
+		Debug:            &debug,
+		Tags:             []string{"a", "b"},
+		Pair:             [2]int{1, 2},
+		Databases:        map[string]decodeTestDatabase{"master": database, "slave": database},
+		Primary:          &database,
+		Extra:            map[string]interface{}{"list": []interface{}{int64(1), 2.5, "three"}},
+		Kept:             "default",
+		Skipped:          "default",
+		Untagged:         7,
+	}
+
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("\nGot: %+v\nExpected: %+v", decoded, expected)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	config, err := Load(strings.NewReader(`
+	[databases.master]
+	host: 42
+	port: 70000
+	timeout: "soon"`), "test.fig")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded decodeTestConfig
+	err = Decode(config, &decoded)
+
+	errs, isErrorList := err.(ErrorList)
+	if !isErrorList || len(errs) != 3 {
+		t.Fatalf("Expected 3 errors, got: %v", err)
+	}
+
+	expectedLines := map[string]int{
+		"databases.master.host":    3,
+		"databases.master.port":    4,
+		"databases.master.timeout": 5,
+	}
+
+	for _, configErr := range errs {
+		if configErr.Kind != TypeConflict || configErr.Filename != "test.fig" || configErr.Line != expectedLines[configErr.KeyPath] {
+			t.Errorf("Unexpected error: %s", configErr)
+		}
+	}
+
+	if err := Decode(config, decoded); err == nil {
+		t.Errorf("Expected an error when decoding into a non-pointer")
+	}
+}
@@ -0,0 +1,207 @@
+package gofigure
+
+import (
+	"strings"
+
+	"github.com/alecthomas/participle"
+	"github.com/alecthomas/participle/lexer"
+)
+
+// ErrorKind - Classifies what went wrong when a configuration failed to load
+type ErrorKind int
+
+const (
+	// SyntaxError - The source could not be lexed or parsed
+	SyntaxError ErrorKind = iota
+	// UnresolvedIdentifier - An identifier or array index refers to a key that does not exist
+	UnresolvedIdentifier
+	// TypeConflict - A value has a different type than the operation on it requires
+	TypeConflict
+	// IncludeFailure - An included file could not be read
+	IncludeFailure
+	// IncludeCycle - A file ends up including itself
+	IncludeCycle
+	// UnknownKey - A key isn't part of the schema or struct it's checked against
+	UnknownKey
+	// MissingKey - A key required by the schema or struct it's checked against has no value
+	MissingKey
+	// InternalError - Something went wrong that isn't tied to a problem in the sources
+	InternalError
+)
+
+var errorKindNames = map[ErrorKind]string{
+	SyntaxError:          "syntax error",
+	UnresolvedIdentifier: "unresolved identifier",
+	TypeConflict:         "type conflict",
+	IncludeFailure:       "include failure",
+	IncludeCycle:         "include cycle",
+	UnknownKey:           "unknown key",
+	MissingKey:           "missing key",
+	InternalError:        "internal error",
+}
+
+func (k ErrorKind) String() string {
+	if name, exists := errorKindNames[k]; exists {
+		return name
+	}
+
+	return "unknown error"
+}
+
+// ConfigError - A diagnostic pointing out where in the .fig sources something went wrong
+type ConfigError struct {
+	Kind ErrorKind
+
+	Filename string
+	Line     int
+	Column   int
+
+	// KeyPath is the dotted path of the key being processed, if any
+	KeyPath string
+	Message string
+
+	// Err is the underlying error, if any
+	Err error
+}
+
+// Position - Returns the source position of the error
+func (e *ConfigError) Position() lexer.Position {
+	return lexer.Position{Filename: e.Filename, Line: e.Line, Column: e.Column}
+}
+
+func (e *ConfigError) Error() string {
+	message := e.Kind.String()
+
+	if e.KeyPath != "" {
+		message += " at \"" + e.KeyPath + "\""
+	}
+
+	return lexer.FormatError(e.Position(), message+": "+e.Message)
+}
+
+// Unwrap - Returns the underlying error
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// checkConfigError - Wraps err in a ConfigError positioned at v, unless err already is one
+func checkConfigError(kind ErrorKind, err error, v GofigureEntry, keyPath string) error {
+	if err == nil {
+		return nil
+	}
+
+	if configErr, isConfigErr := err.(*ConfigError); isConfigErr {
+		return configErr
+	}
+
+	return &ConfigError{
+		Kind:     kind,
+		Filename: v.getFileName(),
+		Line:     v.getLine(),
+		Column:   v.getColumn(),
+		KeyPath:  keyPath,
+		Message:  err.Error(),
+		Err:      err,
+	}
+}
+
+// checkFileError - Turns an error returned from the parser into a positioned syntax error
+func checkFileError(err error, filename string) error {
+	if err == nil {
+		return nil
+	}
+
+	configErr := &ConfigError{
+		Kind:     SyntaxError,
+		Filename: filename,
+		Message:  strings.Replace(err.Error(), "<source>", filename, 1),
+		Err:      err,
+	}
+
+	if parseErr, isParseErr := err.(participle.Error); isParseErr {
+		pos := parseErr.Position()
+
+		configErr.Line = pos.Line
+		configErr.Column = pos.Column
+		configErr.Message = strings.TrimPrefix(err.Error(), lexer.FormatError(pos, ""))
+	}
+
+	return configErr
+}
+
+// DefaultMaxErrors - The number of errors collected by Transform before it gives up
+const DefaultMaxErrors = 20
+
+// ErrorList - All errors collected while transforming a configuration, in the order they were found
+type ErrorList []*ConfigError
+
+func (l ErrorList) Error() string {
+	messages := make([]string, len(l))
+
+	for i, err := range l {
+		messages[i] = err.Error()
+	}
+
+	return strings.Join(messages, "\n")
+}
+
+// Unwrap - Returns the collected errors, so errors.As can find a *ConfigError in the list
+func (l ErrorList) Unwrap() []error {
+	errs := make([]error, len(l))
+
+	for i, err := range l {
+		errs[i] = err
+	}
+
+	return errs
+}
+
+// errorCollector - Accumulates errors across the transform stages, up to a maximum of max errors
+type errorCollector struct {
+	list ErrorList
+	max  int
+}
+
+// add - Records err and reports whether the collector is full, in which case processing should stop
+func (c *errorCollector) add(err error) bool {
+	if err == nil {
+		return c.full()
+	}
+
+	// Errors that weren't given a kind where they were found aren't mistaken for syntax errors
+	configErr, isConfigErr := err.(*ConfigError)
+	if !isConfigErr {
+		configErr = &ConfigError{Kind: InternalError, Message: err.Error(), Err: err}
+	}
+
+	if !c.full() {
+		c.list = append(c.list, configErr)
+	}
+
+	return c.full()
+}
+
+// full - Reports whether the maximum number of errors has been reached. A max below 1 means no limit
+func (c *errorCollector) full() bool {
+	return c.max > 0 && len(c.list) >= c.max
+}
+
+// errorList - Returns err as an ErrorList, so errors of a load all have the same type
+func errorList(err error) error {
+	if _, isErrorList := err.(ErrorList); isErrorList || err == nil {
+		return err
+	}
+
+	errs := &errorCollector{}
+	errs.add(err)
+
+	return errs.err()
+}
+
+func (c *errorCollector) err() error {
+	if len(c.list) == 0 {
+		return nil
+	}
+
+	return c.list
+}
@@ -0,0 +1,241 @@
+package gofigure
+
+import (
+	"errors"
+	"testing"
+)
+
+type ConfigErrorTestCase struct {
+	data    string
+	kind    ErrorKind
+	line    int
+	column  int
+	keyPath string
+}
+
+func TestConfigErrorCases(t *testing.T) {
+	parser, err := BuildParser()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []ConfigErrorTestCase{
+		ConfigErrorTestCase{
+			data:    "key: \"value\"\nother: missing.value",
+			kind:    UnresolvedIdentifier,
+			line:    2,
+			column:  1,
+			keyPath: "other",
+		},
+		ConfigErrorTestCase{
+			data:    "map: {\n  list: [\n    \"value\"\n    missing\n  ]\n}",
+			kind:    UnresolvedIdentifier,
+			line:    4,
+			column:  5,
+			keyPath: "map.list.1",
+		},
+		ConfigErrorTestCase{
+			data:    "[root.%{0...1}]\nkey: \"value\"\n[]\nroot.5.key: \"value\"",
+			kind:    UnresolvedIdentifier,
+			line:    4,
+			column:  6,
+			keyPath: "root.5",
+		},
+		ConfigErrorTestCase{
+			data:    "key: \"value\"\nmap: {\n  url: \"${key}/${missing}\"\n}",
+			kind:    UnresolvedIdentifier,
+			line:    3,
+			column:  8,
+			keyPath: "map.url",
+		},
+		ConfigErrorTestCase{
+			data:    "map: { key: \"value\" }\nurl: \"${map}\"",
+			kind:    TypeConflict,
+			line:    2,
+			column:  6,
+			keyPath: "url",
+		},
+		ConfigErrorTestCase{
+			data:    "url: \"${unterminated\"",
+			kind:    UnresolvedIdentifier,
+			line:    1,
+			column:  6,
+			keyPath: "url",
+		},
+		ConfigErrorTestCase{
+			data:    "name: \"api\"\nmap: {\n  port: 8000 + name\n}",
+			kind:    TypeConflict,
+			line:    3,
+			column:  9,
+			keyPath: "map.port",
+		},
+		ConfigErrorTestCase{
+			data:    "workers: 4\nlist: [1, workers / (workers - 4)]",
+			kind:    TypeConflict,
+			line:    2,
+			column:  11,
+			keyPath: "list.1",
+		},
+		ConfigErrorTestCase{
+			data:    "map: { key: 1 }\ntotal: 1 + map",
+			kind:    TypeConflict,
+			line:    2,
+			column:  12,
+			keyPath: "total",
+		},
+		ConfigErrorTestCase{
+			data:    "big: 9223372036854775807\nmap: {\n  total: big + 1\n}",
+			kind:    TypeConflict,
+			line:    3,
+			column:  10,
+			keyPath: "map.total",
+		},
+		ConfigErrorTestCase{
+			data:    "small: -9223372036854775807\ntotal: small * 2",
+			kind:    TypeConflict,
+			line:    2,
+			column:  8,
+			keyPath: "total",
+		},
+		ConfigErrorTestCase{
+			data:    "small: -9223372036854775807\ntotal: (small - 1) / -1",
+			kind:    TypeConflict,
+			line:    2,
+			column:  8,
+			keyPath: "total",
+		},
+		ConfigErrorTestCase{
+			data:    "total: 1 + missing",
+			kind:    UnresolvedIdentifier,
+			line:    1,
+			column:  12,
+			keyPath: "total",
+		},
+		ConfigErrorTestCase{
+			data:    "arr\narr.0.kk: 1",
+			kind:    TypeConflict,
+			line:    2,
+			column:  5,
+			keyPath: "arr.0",
+		},
+		ConfigErrorTestCase{
+			data:   "key: 1\n[root.%{3...1}]\nkk: 1",
+			kind:   SyntaxError,
+			line:   2,
+			column: 6,
+		},
+		ConfigErrorTestCase{
+			data:   "[root.%{0...99999999999999999999}]\nkk: 1",
+			kind:   SyntaxError,
+			line:   1,
+			column: 6,
+		},
+		ConfigErrorTestCase{
+			data:   "\n  %include \"files/does.not.exist.fig\"",
+			kind:   IncludeFailure,
+			line:   2,
+			column: 3,
+		},
+	}
+
+	for _, testCase := range testCases {
+		config := &FigureConfig{}
+
+		if err := parser.ParseString(testCase.data, config); err != nil {
+			t.Errorf(err.Error())
+			continue
+		}
+
+		_, err := config.Transform()
+
+		var configErr *ConfigError
+		if !errors.As(err, &configErr) {
+			t.Errorf("\nExpected a *ConfigError, got: %v\nFrom:%s", err, testCase.data)
+			continue
+		}
+
+		if configErr.Kind != testCase.kind || configErr.Line != testCase.line || configErr.Column != testCase.column || configErr.KeyPath != testCase.keyPath {
+			t.Errorf("\nGot: %s %d:%d %q\nExpected: %s %d:%d %q\nFrom:%s",
+				configErr.Kind, configErr.Line, configErr.Column, configErr.KeyPath,
+				testCase.kind, testCase.line, testCase.column, testCase.keyPath,
+				testCase.data)
+		}
+	}
+}
+
+func TestSyntaxErrorPosition(t *testing.T) {
+	_, err := ParseFile("files/does.not.exist.fig", nil)
+	if err == nil {
+		t.Fatal("Expected an error for a missing file")
+	}
+
+	parser, err := BuildParser()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = checkFileError(parser.ParseString("key: \"value\"\n  key2: ]", &FigureConfig{}), "test.fig")
+
+	configErr, isConfigErr := err.(*ConfigError)
+	if !isConfigErr {
+		t.Fatalf("Expected a *ConfigError, got: %v", err)
+	}
+
+	if configErr.Kind != SyntaxError || configErr.Filename != "test.fig" || configErr.Line != 2 {
+		t.Errorf("Got: %s in %s:%d:%d", configErr.Kind, configErr.Filename, configErr.Line, configErr.Column)
+	}
+}
+
+func TestErrorsAreCollected(t *testing.T) {
+	parser, err := BuildParser()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := `
+	%include "files/does.not.exist.fig"
+	first: missing.first
+	second: [missing.second]
+	third: { key: missing.third }`
+
+	config := &FigureConfig{}
+	if err := parser.ParseString(data, config); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = config.TransformMaxErrors(0)
+
+	errs, isErrorList := err.(ErrorList)
+	if !isErrorList || len(errs) != 4 {
+		t.Fatalf("Expected 4 collected errors, got: %v", err)
+	}
+
+	expectedKinds := []ErrorKind{IncludeFailure, UnresolvedIdentifier, UnresolvedIdentifier, UnresolvedIdentifier}
+	for i, kind := range expectedKinds {
+		if errs[i].Kind != kind {
+			t.Errorf("Error %d: got kind %s, expected %s", i, errs[i].Kind, kind)
+		}
+	}
+
+	config = &FigureConfig{}
+	if err := parser.ParseString(data, config); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = config.TransformMaxErrors(2)
+
+	if errs, isErrorList := err.(ErrorList); !isErrorList || len(errs) != 2 {
+		t.Errorf("Expected the error list to be capped at 2, got: %v", err)
+	}
+}
+
+func TestUnpositionedErrorsAreInternal(t *testing.T) {
+	errs := &errorCollector{}
+	errs.add(errors.New("unexpected"))
+	errs.add(&ConfigError{Kind: TypeConflict, Message: "positioned"})
+
+	list, isErrorList := errs.err().(ErrorList)
+	if !isErrorList || len(list) != 2 || list[0].Kind != InternalError || list[1].Kind != TypeConflict {
+		t.Errorf("Expected an internal error and a type conflict, got: %v", errs.err())
+	}
+}
@@ -0,0 +1,267 @@
+package gofigure
+
+import (
+	"errors"
+	"math"
+)
+
+// isExpression - Reports whether v has to be evaluated before it can be used
+func (v *Value) isExpression() bool {
+	return v.Operations != nil || v.Group != nil
+}
+
+// evaluateExpression - Evaluates the expression v to a single integer, float or string value.
+// Identifiers and strings in it are resolved like anywhere else, and type errors are reported
+// at the position of the expression
+func evaluateExpression(v *Value, root *FigureConfig, scope *includeScope, path string, errs *errorCollector) *Value {
+	if result := evaluate(v, root, scope, path, errs); result != nil {
+		return result
+	}
+
+	return v
+}
+
+// evaluate - Evaluates the expression v, or returns nil after reporting why it can't be
+func evaluate(v *Value, root *FigureConfig, scope *includeScope, path string, errs *errorCollector) *Value {
+	operands, operators := v.flattenExpression()
+
+	values := make([]*Value, len(operands))
+
+	for i, operand := range operands {
+		values[i] = evaluateOperand(operand, root, scope, path, errs)
+
+		if values[i] == nil {
+			return nil
+		}
+	}
+
+	result, err := applyOperators(values, operators)
+
+	if errs.add(checkConfigError(TypeConflict, err, v, path)) || err != nil {
+		return nil
+	}
+
+	result.Pos = v.Pos
+
+	return result
+}
+
+// flattenExpression - Lists the operands of the expression v and the operators between them.
+// Operands are copies without operations of their own, except for parenthesised groups
+func (v *Value) flattenExpression() (operands []*Value, operators []string) {
+	operand := *v
+	operand.Operations = nil
+	operands = append(operands, &operand)
+
+	for _, operation := range v.Operations {
+		rest, restOperators := operation.Operand.flattenExpression()
+
+		operators = append(append(operators, operation.Operator), restOperators...)
+		operands = append(operands, rest...)
+	}
+
+	return
+}
+
+// evaluateOperand - Resolves an operand of an expression to a scalar, or returns nil after
+// reporting why it can't be
+func evaluateOperand(operand *Value, root *FigureConfig, scope *includeScope, path string, errs *errorCollector) *Value {
+	v := operand
+
+	switch {
+	case v.Group != nil:
+		if v = evaluate(v.Group, root, scope, path, errs); v == nil {
+			return nil
+		}
+
+	case v.Identifier != nil:
+		identVal, err := scope.findIdentifier(v.Identifier, root, errs)
+
+		if errs.add(checkConfigError(UnresolvedIdentifier, err, operand, path)) || err != nil {
+			return nil
+		}
+
+		v = identVal
+
+	case v.MultilineString != nil:
+		str := v.MultilineString.transform()
+		v = &Value{String: &str, Pos: v.Pos}
+	}
+
+	if v != nil && v.String != nil && !v.literal {
+		v = interpolateValue(v, root, scope, path, errs)
+
+		if containsReference(*v.String) {
+			return nil
+		}
+	}
+
+	if v == nil || (v.String == nil && v.Integer == nil && v.Float == nil) {
+		errs.add(checkConfigError(TypeConflict, errors.New("Only strings, integers and floats can be used in expressions"), operand, path))
+		return nil
+	}
+
+	return v
+}
+
+// applyOperators - Applies the operators between values, *, / and % before + and -
+func applyOperators(values []*Value, operators []string) (*Value, error) {
+	terms := []*Value{values[0]}
+	termOperators := []string{}
+
+	for i, operator := range operators {
+		if operator == "+" || operator == "-" {
+			terms = append(terms, values[i+1])
+			termOperators = append(termOperators, operator)
+			continue
+		}
+
+		result, err := applyOperator(terms[len(terms)-1], operator, values[i+1])
+
+		if err != nil {
+			return nil, err
+		}
+
+		terms[len(terms)-1] = result
+	}
+
+	result := terms[0]
+
+	for i, operator := range termOperators {
+		var err error
+
+		if result, err = applyOperator(result, operator, terms[i+1]); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+func applyOperator(left *Value, operator string, right *Value) (*Value, error) {
+	switch {
+	case left.String != nil || right.String != nil:
+		if left.String == nil || right.String == nil || operator != "+" {
+			return nil, errors.New("Cannot apply " + operator + " to " + left.describe() + " and " + right.describe())
+		}
+
+		// Strings are joined in their escaped form, so interpolated parts aren't interpolated again
+		str := left.escapedString() + right.escapedString()
+
+		return &Value{String: &str}, nil
+
+	case left.Integer != nil && right.Integer != nil:
+		integer, err := applyIntegerOperator(*left.Integer, operator, *right.Integer)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &Value{Integer: &integer}, nil
+	}
+
+	if operator == "%" {
+		return nil, errors.New("Cannot apply % to " + left.describe() + " and " + right.describe())
+	}
+
+	float, err := applyFloatOperator(left.toFloat(), operator, right.toFloat())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Value{Float: &float}, nil
+}
+
+// applyIntegerOperator - Applies an operator to two integers, reporting results that don't fit in
+// an integer instead of letting them wrap around
+func applyIntegerOperator(left int64, operator string, right int64) (int64, error) {
+	overflow := errors.New("Result of " + operator + " overflows an integer")
+
+	switch operator {
+	case "+":
+		if (right > 0 && left > math.MaxInt64-right) || (right < 0 && left < math.MinInt64-right) {
+			return 0, overflow
+		}
+
+		return left + right, nil
+	case "-":
+		if (right < 0 && left > math.MaxInt64+right) || (right > 0 && left < math.MinInt64+right) {
+			return 0, overflow
+		}
+
+		return left - right, nil
+	case "*":
+		if left != 0 && right != 0 && (left*right/right != left || (left == math.MinInt64 && right == -1)) {
+			return 0, overflow
+		}
+
+		return left * right, nil
+	}
+
+	if right == 0 {
+		return 0, errors.New("Division by zero")
+	}
+
+	if operator == "/" {
+		if left == math.MinInt64 && right == -1 {
+			return 0, overflow
+		}
+
+		return left / right, nil
+	}
+
+	return left % right, nil
+}
+
+func applyFloatOperator(left float64, operator string, right float64) (float64, error) {
+	var result float64
+
+	switch operator {
+	case "+":
+		result = left + right
+	case "-":
+		result = left - right
+	case "*":
+		result = left * right
+	case "/":
+		if right == 0 {
+			return 0, errors.New("Division by zero")
+		}
+
+		result = left / right
+	}
+
+	if math.IsInf(result, 0) {
+		return 0, errors.New("Result of " + operator + " overflows a float")
+	}
+
+	return result, nil
+}
+
+func (v *Value) toFloat() float64 {
+	if v.Integer != nil {
+		return float64(*v.Integer)
+	}
+
+	return *v.Float
+}
+
+func (v *Value) escapedString() string {
+	if v.literal {
+		return escapeInterpolation(*v.String)
+	}
+
+	return *v.String
+}
+
+func (v *Value) describe() string {
+	switch {
+	case v.String != nil:
+		return "a string"
+	case v.Integer != nil:
+		return "an integer"
+	}
+
+	return "a float"
+}
@@ -0,0 +1,9 @@
+module github.com/shellkjell/gofigure
+
+go 1.20
+
+require (
+	github.com/BurntSushi/toml v1.3.2
+	github.com/alecthomas/participle v0.4.1
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,174 @@
+// Package gofigure is a fully functional configuration file parser with bells on.
+//
+// A .fig source is first parsed into a FigureConfig, which mirrors the syntax of the
+// file, and then transformed into a Config, a tree of maps, slices and scalar values
+// with all includes, sections and identifiers resolved:
+//
+//	config, err := gofigure.LoadFile("config.fig")
+//	if err != nil {
+//		// err is always an ErrorList of positioned *ConfigError values
+//	}
+//
+//	host, err := config.Lookup("production.database.host")
+package gofigure
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/participle/lexer"
+)
+
+// Config - A fully transformed configuration
+type Config struct {
+	root *OrderedMap
+
+	positions positionTable
+}
+
+// positionKey - Identifies a map, slice or scalar pointer in a transformed configuration
+type positionKey struct {
+	kind    reflect.Kind
+	pointer uintptr
+}
+
+// positionTable - Maps the values of a transformed configuration back to where they were defined.
+// Values are identified by their pointer, so plain strings and empty slices aren't tracked
+type positionTable map[positionKey]lexer.Position
+
+func newPositionKey(value interface{}) (positionKey, bool) {
+	rv := reflect.ValueOf(value)
+
+	switch rv.Kind() {
+	case reflect.Map, reflect.Ptr:
+		return positionKey{rv.Kind(), rv.Pointer()}, !rv.IsNil()
+	case reflect.Slice:
+		return positionKey{rv.Kind(), rv.Pointer()}, rv.Len() > 0
+	}
+
+	return positionKey{}, false
+}
+
+func (t positionTable) record(value interface{}, pos lexer.Position) {
+	if key, ok := newPositionKey(value); ok {
+		t[key] = pos
+	}
+}
+
+func (t positionTable) lookup(value interface{}) (pos lexer.Position, exists bool) {
+	if key, ok := newPositionKey(value); ok {
+		pos, exists = t[key]
+	}
+
+	return
+}
+
+// Root - Returns the configuration as a tree of *OrderedMap, []interface{} and *string,
+// *int64, *float64 and *Bool values, with map keys in the order they were first defined
+func (c *Config) Root() *OrderedMap {
+	return c.root
+}
+
+// Map - Returns the configuration as a tree of map[string]interface{}, []interface{} and
+// *string, *int64, *float64 and *Bool values
+func (c *Config) Map() map[string]interface{} {
+	return c.root.ToMap()
+}
+
+// Lookup - Returns the value at the dotted key path, e.g. "production.database.host" or
+// "servers.0.name" for an element of an array
+func (c *Config) Lookup(path string) (interface{}, error) {
+	value, _, err := c.find(path)
+
+	return value, err
+}
+
+// Explain - Returns every place in the .fig sources that defined or overrode the value at the
+// dotted key path, oldest first, e.g. the section that set "production.database.slave.password"
+// and then the one that overrode it. Array elements, as in "servers.0", have the position of
+// the element, or the origins of the array when the element has no position of its own
+func (c *Config) Explain(path string) ([]Origin, error) {
+	_, origins, err := c.find(path)
+
+	return origins, err
+}
+
+// find - Returns the value at the dotted key path and the origins of the key it's in, indexing
+// into arrays with the keys that are numbers
+func (c *Config) find(path string) (interface{}, []Origin, error) {
+	var current interface{} = c.root
+	var origins []Origin
+
+	keyNames := strings.Split(path, ".")
+
+	for i, keyName := range keyNames {
+		switch node := current.(type) {
+		case *OrderedMap:
+			value, exists := node.Get(keyName)
+			if !exists {
+				return nil, nil, errors.New("No key with the name \"" + keyName + "\" exists. From query: \"" + path + "\"")
+			}
+
+			current, origins = value, node.Origins(keyName)
+
+		case []interface{}:
+			index, err := strconv.Atoi(keyName)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, nil, errors.New("No element with index " + keyName + " exists. From query: \"" + path + "\"")
+			}
+
+			current = node[index]
+
+			if pos, exists := c.positions.lookup(current); exists {
+				origins = []Origin{{Pos: pos}}
+			}
+
+		default:
+			return nil, nil, errors.New("Key with the name \"" + keyNames[i-1] + "\" is not a map or an array. From query: \"" + path + "\"")
+		}
+	}
+
+	return current, origins, nil
+}
+
+// MarshalJSON - Marshals the configuration as a JSON object, keeping the order of its keys
+func (c *Config) MarshalJSON() ([]byte, error) {
+	return c.root.MarshalJSON()
+}
+
+// namedReader - Lets the lexer put filename in the positions of sources that aren't files
+type namedReader struct {
+	io.Reader
+
+	name string
+}
+
+func (r namedReader) Name() string {
+	return r.name
+}
+
+// Parse - Parses a .fig source read from r without transforming it. The filename is only
+// used for positions in errors
+func Parse(r io.Reader, filename string) (*FigureConfig, error) {
+	return NewLoader().Parse(r, filename)
+}
+
+// Load - Parses and transforms a .fig source read from r. Includes are resolved relative
+// to the directory of filename
+func Load(r io.Reader, filename string) (*Config, error) {
+	return NewLoader().Load(r, filename)
+}
+
+// LoadFile - Parses and transforms the .fig file with the given filename. Includes are
+// resolved relative to the file including them
+func LoadFile(filename string) (*Config, error) {
+	return NewLoader().LoadFile(filename)
+}
+
+// LoadFiles - Parses and transforms .fig files layered in order, see Loader.LoadFiles
+func LoadFiles(filenames ...string) (*Config, error) {
+	return NewLoader().LoadFiles(filenames...)
+}
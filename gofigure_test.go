@@ -0,0 +1,89 @@
+package gofigure
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadAndLookup(t *testing.T) {
+	config, err := Load(strings.NewReader(`
+	[database.%{master,slave}]
+	host: "localhost"
+	port: 5432`), "test.fig")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host, err := config.Lookup("database.slave.host")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if str, isString := host.(*string); !isString || *str != "localhost" {
+		t.Errorf("Got: %v, expected: \"localhost\"", host)
+	}
+
+	if _, err := config.Lookup("database.slave.missing"); err == nil {
+		t.Errorf("Expected an error when looking up a missing key")
+	}
+
+	arrays, err := Load(strings.NewReader(`servers: [{ name: "a" }, { name: "b" }] ports: [80, 443]`), "test.fig")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name, err := arrays.Lookup("servers.1.name"); err != nil || plainScalar(name) != "b" {
+		t.Errorf("Expected servers.1.name to be \"b\", got: %v %v", name, err)
+	}
+
+	if port, err := arrays.Lookup("ports.1"); err != nil || plainScalar(port) != int64(443) {
+		t.Errorf("Expected ports.1 to be 443, got: %v %v", port, err)
+	}
+
+	for _, path := range []string{"servers.2", "ports.0.number"} {
+		if _, err := arrays.Lookup(path); err == nil {
+			t.Errorf("Expected an error when looking up %s", path)
+		}
+	}
+
+	marshaled, err := config.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"database":{"master":{"host":"localhost","port":5432},"slave":{"host":"localhost","port":5432}}}`
+	if string(marshaled) != expected {
+		t.Errorf("\nGot: %s\nExpected: %s", marshaled, expected)
+	}
+}
+
+func TestLoadReportsFilename(t *testing.T) {
+	_, err := Load(strings.NewReader("key: missing"), "test.fig")
+
+	errs, isErrorList := err.(ErrorList)
+	if !isErrorList || len(errs) != 1 {
+		t.Fatalf("Expected one error, got: %v", err)
+	}
+
+	if errs[0].Filename != "test.fig" {
+		t.Errorf("Got filename %q, expected \"test.fig\"", errs[0].Filename)
+	}
+
+	_, err = Load(strings.NewReader("key: ]"), "syntax.fig")
+
+	errs, isErrorList = err.(ErrorList)
+	if !isErrorList || len(errs) != 1 || errs[0].Kind != SyntaxError || errs[0].Filename != "syntax.fig" {
+		t.Errorf("Expected a syntax error in syntax.fig, got: %v", err)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	config, err := LoadFile("files/config.define_roots.fig")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := config.Lookup("production.locale"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,286 @@
+package gofigure
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// interpolate - Replaces every ${reference} in str with what replace returns for it, which has to
+// be escaped with escapeInterpolation so later stages keep it as it is. References that replace
+// leaves alone, and references escaped as $${reference}, are kept as they are
+func interpolate(str string, replace func(reference string) (string, bool, error)) (string, error) {
+	var interpolated strings.Builder
+
+	for i := 0; i < len(str); {
+		if strings.HasPrefix(str[i:], "$${") {
+			interpolated.WriteString("$${")
+			i += 3
+			continue
+		}
+
+		if !strings.HasPrefix(str[i:], "${") {
+			interpolated.WriteByte(str[i])
+			i++
+			continue
+		}
+
+		end := strings.IndexByte(str[i+2:], '}')
+
+		if end < 0 {
+			return "", errors.New("Reference \"" + str[i:] + "\" is missing its closing }")
+		}
+
+		reference := strings.TrimSpace(str[i+2 : i+2+end])
+		replacement, replaced, err := replace(reference)
+
+		if err != nil {
+			return "", err
+		}
+
+		if replaced {
+			interpolated.WriteString(replacement)
+		} else {
+			interpolated.WriteString(str[i : i+3+end])
+		}
+
+		i += 3 + end
+	}
+
+	return interpolated.String(), nil
+}
+
+// containsReference - Reports whether str has a ${reference} that isn't escaped
+func containsReference(str string) bool {
+	for i := 0; i < len(str); i++ {
+		if strings.HasPrefix(str[i:], "$${") {
+			i += 2
+		} else if strings.HasPrefix(str[i:], "${") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// escapeInterpolation - Escapes every ${ in str, so it's kept as it is
+func escapeInterpolation(str string) string {
+	return strings.ReplaceAll(str, "${", "$${")
+}
+
+// unescapeInterpolation - Turns every $${ in str into ${, once all references have been replaced
+func unescapeInterpolation(str string) string {
+	var unescaped strings.Builder
+
+	for i := 0; i < len(str); {
+		if strings.HasPrefix(str[i:], "$${") {
+			unescaped.WriteString("${")
+			i += 3
+			continue
+		}
+
+		unescaped.WriteByte(str[i])
+		i++
+	}
+
+	return unescaped.String()
+}
+
+// lookupEnv - Looks up an environment variable, which always reads as unset when DisableEnv is set
+func (l *Loader) lookupEnv(name string) (string, bool) {
+	if l.DisableEnv {
+		return "", false
+	}
+
+	if l.LookupEnv != nil {
+		return l.LookupEnv(name)
+	}
+
+	return os.LookupEnv(name)
+}
+
+// envValue - Returns the value of the environment variable name, or defaultValue when it's unset
+// or empty. Without a default, an unset variable is an error
+func (l *Loader) envValue(name string, defaultValue *string) (string, error) {
+	value, exists := l.lookupEnv(name)
+
+	if (!exists || value == "") && defaultValue != nil {
+		return *defaultValue, nil
+	}
+
+	if !exists {
+		if l.DisableEnv {
+			return "", errors.New("Environment variable " + name + " has no default, and environment variables are disabled")
+		}
+
+		return "", errors.New("Environment variable " + name + " is not set")
+	}
+
+	return value, nil
+}
+
+// envReference - Replaces references written as ${env:NAME} or ${env:NAME:-default}
+func (l *Loader) envReference(reference string) (string, bool, error) {
+	if !strings.HasPrefix(reference, "env:") {
+		return "", false, nil
+	}
+
+	name := strings.TrimPrefix(reference, "env:")
+
+	var defaultValue *string
+
+	if i := strings.Index(name, ":-"); i >= 0 {
+		value := name[i+2:]
+		name, defaultValue = name[:i], &value
+	}
+
+	value, err := l.envValue(name, defaultValue)
+
+	return escapeInterpolation(value), true, err
+}
+
+// resolveEnv - Replaces the env(...) values of c, and the ${env:...} references in its strings,
+// with the values of the environment variables
+func (l *load) resolveEnv(c FigureConfig) {
+	for _, entry := range c.Entries {
+		if entry.Field != nil {
+			l.resolveEnvInField(entry.Field, "")
+		} else if entry.Section != nil {
+			for _, field := range entry.Section.Fields {
+				l.resolveEnvInField(field, "")
+			}
+		} else if entry.Include != nil {
+			for _, param := range entry.Include.Params {
+				l.resolveEnvInField(param, "")
+			}
+		}
+	}
+}
+
+func (l *load) resolveEnvInField(f *Field, path string) {
+	if f.Include != nil {
+		for _, param := range f.Include.Params {
+			l.resolveEnvInField(param, "")
+		}
+
+		return
+	}
+
+	path = joinPath(path, f.Key)
+
+	for child := f.Child; child != nil; child = child.Child {
+		path = joinPath(path, child.Key)
+
+		if child.Value != nil {
+			l.resolveEnvInValue(child.Value, path)
+		}
+	}
+
+	if f.Value != nil {
+		l.resolveEnvInValue(f.Value, path)
+	}
+}
+
+func (l *load) resolveEnvInValue(v *Value, path string) {
+	if v.MultilineString != nil && strings.Contains(*v.MultilineString.String, "${") {
+		str := v.MultilineString.transform()
+		v.String, v.MultilineString = &str, nil
+	}
+
+	switch {
+	case v.Env != nil:
+		value, err := l.envValue(v.Env.Name, v.Env.Default)
+		l.errs.add(checkConfigError(UnresolvedIdentifier, err, v, path))
+
+		v.String, v.Env, v.literal = &value, nil, true
+
+	case v.String != nil && !v.literal:
+		interpolated, err := interpolate(*v.String, l.envReference)
+
+		if err != nil {
+			l.errs.add(checkConfigError(UnresolvedIdentifier, err, v, path))
+
+			// The string is left as it is, so the error isn't reported again for its other references
+			v.literal = true
+			return
+		}
+
+		v.String = &interpolated
+
+	case v.Map != nil:
+		for _, field := range v.Map {
+			l.resolveEnvInField(field, path)
+		}
+
+	case v.ParsedArray != nil:
+		for _, value := range v.ParsedArray {
+			if value != nil {
+				l.resolveEnvInValue(value, path)
+			}
+		}
+
+	case v.Group != nil:
+		l.resolveEnvInValue(v.Group, path)
+	}
+
+	for _, operation := range v.Operations {
+		l.resolveEnvInValue(operation.Operand, path)
+	}
+}
+
+// interpolateValue - Returns a copy of the string value v with its ${path} references replaced by
+// the scalars that the identifiers path resolve to
+func interpolateValue(v *Value, root *FigureConfig, scope *includeScope, path string, errs *errorCollector) *Value {
+	interpolated, err := interpolate(*v.String, func(reference string) (string, bool, error) {
+		referenced, err := scope.findIdentifier(&reference, root, errs)
+
+		if err != nil {
+			return "", false, checkConfigError(UnresolvedIdentifier, err, v, path)
+		}
+
+		replacement, err := referenced.interpolationText()
+
+		if err != nil {
+			return "", false, checkConfigError(TypeConflict, errors.New("Reference \"${"+reference+"}\" "+err.Error()), v, path)
+		}
+
+		return replacement, true, nil
+	})
+
+	if errs.add(checkConfigError(UnresolvedIdentifier, err, v, path)) || err != nil {
+		return v
+	}
+
+	newValue := *v
+	newValue.String = &interpolated
+
+	return &newValue
+}
+
+// interpolationText - Returns the scalar v as text to replace a reference with, escaped
+func (v *Value) interpolationText() (string, error) {
+	switch {
+	case v == nil:
+		return "", errors.New("has no value")
+	case v.String != nil && v.literal:
+		return escapeInterpolation(*v.String), nil
+	case v.String != nil:
+		// Strings are interpolated in the order they're defined, so later ones aren't resolved yet
+		if containsReference(*v.String) {
+			return "", errors.New("refers to a string that isn't resolved yet")
+		}
+
+		return *v.String, nil
+	case v.MultilineString != nil:
+		return v.MultilineString.transform(), nil
+	case v.Integer != nil:
+		return strconv.FormatInt(*v.Integer, 10), nil
+	case v.Float != nil:
+		return strconv.FormatFloat(*v.Float, 'g', -1, 64), nil
+	case v.Boolean != nil:
+		return strconv.FormatBool(bool(*v.Boolean)), nil
+	}
+
+	return "", errors.New("has to refer to a string, number or boolean")
+}
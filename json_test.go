@@ -1,8 +1,9 @@
-package main
+package gofigure
 
 import (
 	"encoding/json"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -12,7 +13,10 @@ type MarshalJSONTestCase struct {
 }
 
 func TestJsonMarshalCases(t *testing.T) {
-	parser := BuildParser()
+	parser, err := BuildParser()
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	testCases := []MarshalJSONTestCase{
 		MarshalJSONTestCase{
@@ -99,7 +103,6 @@ func TestJsonMarshalCases(t *testing.T) {
 		quote_value: \"
 		array_value: \[
 		*/
-		// Maybe do something to ensure determinism here
 		MarshalJSONTestCase{
 			data:     `Rick_Astley:"Never" \":"gonna" \[:"give" %include "files/config.special.fig"`,
 			expected: `{"Rick_Astley":"Never","\\\"":"gonna","\\[":"give","quote_value":"gonna","array_value":"give","empty_value":null}`,
@@ -109,6 +112,61 @@ func TestJsonMarshalCases(t *testing.T) {
 			data:     `[root, root2 root3] key:"value"`,
 			expected: `{"root":{"key":"value"},"root2":{"key":"value"},"root3":{"key":"value"}}`,
 		},
+
+		MarshalJSONTestCase{
+			data: `
+			[database.master]
+				host: "db"
+				port: 5432
+				tls: true
+			[]
+			url: "postgres://${database.master.host}:${ database.master.port }/app?tls=${database.master.tls}"
+			ratio: 0.5
+			urls: ["${url}", { text: """ratio ${ratio}""" }]
+			escaped: "$${database.master.host}"`,
+			expected: `{"database":{"master":{"host":"db","port":5432,"tls":true}},"url":"postgres://db:5432/app?tls=true","ratio":0.5,"urls":["postgres://db:5432/app?tls=true",{"text":"ratio 0.5"}],"escaped":"${database.master.host}"}`,
+		},
+
+		MarshalJSONTestCase{
+			data: `
+			base_timeout: 30
+			workers: 4
+			prefix: "billing"
+			timeout: base_timeout * 2
+			max_conns: workers + 4 * 2 - (workers - 1) % 2
+			ratio: workers / 8.0
+			half: (workers + 1) / 2
+			name: prefix + "-api"
+			url: "${name}:" + """v${workers}"""
+			list: [workers * -1, { nested: timeout - base_timeout }]`,
+			expected: `{"base_timeout":30,"workers":4,"prefix":"billing","timeout":60,"max_conns":11,"ratio":0.5,"half":2,"name":"billing-api","url":"billing-api:v4","list":[-4,{"nested":30}]}`,
+		},
+
+		MarshalJSONTestCase{
+			data: `
+			bare
+			explicit: null
+			map: {}
+			array: []
+			spaced_array: [ ]
+			nested: [[], {}, null, [null]]
+			[root]
+			[]
+			[other]
+			key: "value"
+			[other]
+			key: null`,
+			expected: `{"bare":null,"explicit":null,"map":{},"array":[],"spaced_array":[],"nested":[[],{},null,[null]],"root":{},"other":{"key":null}}`,
+		},
+
+		MarshalJSONTestCase{
+			data: `
+			[list.%{0...1}]
+			name: "x"
+			[]
+			empty: {}`,
+			expected: `{"list":[{"name":"x"},{"name":"x"}],"empty":{}}`,
+		},
 	}
 
 	for _, testCase := range testCases {
@@ -116,14 +174,18 @@ func TestJsonMarshalCases(t *testing.T) {
 
 		parser.ParseString(testCase.data, config)
 
-		mappedConfig := config.Transform()
+		mappedConfig, err := config.Transform()
+		if err != nil {
+			t.Errorf(err.Error())
+			continue
+		}
 
 		marshaled, _ := json.Marshal(mappedConfig)
 
 		actual := map[string]interface{}{}
 		expected := map[string]interface{}{}
 
-		err := json.Unmarshal(marshaled, &actual)
+		err = json.Unmarshal(marshaled, &actual)
 		if err != nil {
 			t.Errorf(err.Error())
 		}
@@ -138,3 +200,88 @@ func TestJsonMarshalCases(t *testing.T) {
 		}
 	}
 }
+
+func TestTransformErrorCases(t *testing.T) {
+	parser, err := BuildParser()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []string{
+		`key: missing.value`,
+		`list: [missing]`,
+		`map: { key: missing }`,
+		`%include "files/does.not.exist.fig"`,
+		`[root.%{0...1}] key: "value" [] root.5.key: "value"`,
+	}
+
+	for _, testCase := range testCases {
+		config := &FigureConfig{}
+
+		if err := parser.ParseString(testCase, config); err != nil {
+			t.Errorf(err.Error())
+			continue
+		}
+
+		if _, err := config.Transform(); err == nil {
+			t.Errorf("\nExpected an error from:%s", testCase)
+		}
+	}
+}
+
+func TestJsonKeyOrder(t *testing.T) {
+	testCases := []MarshalJSONTestCase{
+		MarshalJSONTestCase{
+			data:     `Rick_Astley:"Never" \":"gonna" \[:"give" %include "files/config.special.fig"`,
+			expected: `{"Rick_Astley":"Never","\\\"":"gonna","\\[":"give","empty_value":null,"quote_value":"gonna","array_value":"give"}`,
+		},
+
+		MarshalJSONTestCase{
+			data:     `zebra: 1 [root] yak: 2 xerus: 3 [] apple: 4 root.wombat: 5 [@] aardvark: 6`,
+			expected: `{"zebra":1,"root":{"yak":2,"xerus":3,"wombat":5,"aardvark":6},"apple":4}`,
+		},
+
+		MarshalJSONTestCase{
+			data:     `[root] aa.bb: 1 cc: { dd.ee: 2 } ff: [{ gg.hh: 3 }]`,
+			expected: `{"root":{"aa":{"bb":1},"cc":{"dd":{"ee":2}},"ff":[{"gg":{"hh":3}}]}}`,
+		},
+
+		MarshalJSONTestCase{
+			data:     `[%{dev,prod}] [@.db.%{master,slave}] [@.db.@] host: "a" [prod.db] master.host: "b"`,
+			expected: `{"dev":{"db":{"master":{"host":"a"},"slave":{"host":"a"}}},"prod":{"db":{"master":{"host":"b"},"slave":{"host":"a"}}}}`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		config, err := Load(strings.NewReader(testCase.data), "test.fig")
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		marshaled, err := json.Marshal(config)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if string(marshaled) != testCase.expected {
+			t.Errorf("\nGot: %s\nExpected: %s\nFrom:%s", string(marshaled), testCase.expected, testCase.data)
+		}
+	}
+
+	sorted, err := (&Loader{SortKeys: true}).Load(strings.NewReader(testCases[1].data), "test.fig")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marshaled, err := json.Marshal(sorted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"apple":4,"root":{"aardvark":6,"wombat":5,"xerus":3,"yak":2},"zebra":1}`
+	if string(marshaled) != expected {
+		t.Errorf("\nGot: %s\nExpected: %s", string(marshaled), expected)
+	}
+}
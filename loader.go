@@ -0,0 +1,823 @@
+package gofigure
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/participle"
+	"github.com/alecthomas/participle/lexer"
+)
+
+// Loader - Parses and transforms configurations. A Loader holds no state between loads,
+// so one Loader, or many, can be used from several goroutines at once
+type Loader struct {
+	// FS is the file system that files and includes are read from, such as an embed.FS or an
+	// fstest.MapFS. A nil FS reads from the file system of the operating system
+	FS fs.FS
+
+	// Dir is the directory that the filenames given to the Loader are resolved against. An empty
+	// Dir means the current working directory of the process, or the root of FS when it's set.
+	// Includes are resolved against the directory of the file including them
+	Dir string
+
+	// Stdin is read for the filename "-" given to LoadFile and LoadFiles, whose includes are then
+	// resolved against Dir. A nil Stdin reads from os.Stdin
+	Stdin io.Reader
+
+	// MaxErrors is the number of errors collected before a load gives up. Below 1 means no limit
+	MaxErrors int
+
+	// DataFormats are the decoders of data formats that can be included besides JSON, YAML and
+	// TOML, by name, and replace the built in decoder of the same name. A file is included as data
+	// when the include names its format, as in %include ini "file.ini", or when its extension is
+	// the name of a format
+	DataFormats map[string]DataDecoder
+
+	// IncludePaths are the directories searched, in order, for included files that don't exist
+	// relative to the file including them. Within FS, they are directories in FS
+	IncludePaths []string
+
+	// MaxIncludeDepth is the number of files includes may nest before a load gives up. Below 1
+	// means no limit
+	MaxIncludeDepth int
+
+	// Defines are the variables that %if conditions check, as defined with -D name=value
+	Defines map[string]string
+
+	// Profile selects one of the top level maps, such as production in [%{dev,production}], to be
+	// the whole configuration. It's also the variable profile of %if conditions, unless Defines
+	// has its own
+	Profile string
+
+	// ProfileShared merges the top level keys that aren't maps, and so are shared by every
+	// profile, into the selected profile. Keys of the profile take precedence over them
+	ProfileShared bool
+
+	// Overrides set key paths to values after every file has been loaded, as in
+	// production.database.host=10.0.0.5. Values are written as in .fig, so they can be any value,
+	// or else are taken as a string, and they merge into the configuration like keys defined at
+	// the end of the last file. Errors in the nth override are reported on line n of -set
+	Overrides []string
+
+	// DisableEnv makes every environment variable read as unset, so loads don't depend on the
+	// environment. Environment values then take their defaults, and are errors without one
+	DisableEnv bool
+
+	// LookupEnv looks up the environment variables of env("NAME") values and ${env:NAME} references.
+	// A nil LookupEnv uses os.LookupEnv
+	LookupEnv func(name string) (string, bool)
+
+	// OmitEmpty leaves out keys that are null, such as bare keys, or empty maps or arrays, as
+	// well as maps that only had such keys
+	OmitEmpty bool
+
+	// SortKeys sorts the keys of every map alphabetically instead of keeping the order they
+	// were first defined in
+	SortKeys bool
+}
+
+// DefaultMaxIncludeDepth - The number of files includes may nest in a Loader from NewLoader
+const DefaultMaxIncludeDepth = 32
+
+// NewLoader - Returns a Loader resolving files against the current working directory
+func NewLoader() *Loader {
+	return &Loader{MaxErrors: DefaultMaxErrors, MaxIncludeDepth: DefaultMaxIncludeDepth}
+}
+
+// load - The state of a single load: its parser, include cache and collected errors
+type load struct {
+	*Loader
+
+	parser *participle.Parser
+
+	// sources caches the contents of every file read during the load, by resolved path
+	sources map[string][]byte
+
+	errs *errorCollector
+
+	// defines are the variables of %if conditions, Defines along with the profile
+	defines map[string]string
+
+	// including holds the files whose includes are being parsed, outermost first
+	including []includingFile
+}
+
+// includingFile - A file whose includes are being parsed, and the include statement being followed in it
+type includingFile struct {
+	resolved string
+	include  *Include
+}
+
+func (l *Loader) newLoad() (*load, error) {
+	parser, err := BuildParser()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defines := l.Defines
+
+	if _, defined := defines["profile"]; l.Profile != "" && !defined {
+		defines = map[string]string{"profile": l.Profile}
+
+		for name, value := range l.Defines {
+			defines[name] = value
+		}
+	}
+
+	return &load{
+		Loader:  l,
+		parser:  parser,
+		sources: map[string][]byte{},
+		errs:    &errorCollector{max: l.MaxErrors},
+		defines: defines,
+	}, nil
+}
+
+// resolvePath - Resolves filename against dir. Within FS, absolute filenames are resolved
+// against the root of FS
+func (l *Loader) resolvePath(dir, filename string) string {
+	if l.FS != nil {
+		if path.IsAbs(filename) {
+			return strings.TrimPrefix(path.Clean(filename), "/")
+		}
+
+		return path.Join(dir, filename)
+	}
+
+	if dir == "" || filepath.IsAbs(filename) {
+		return filepath.Clean(filename)
+	}
+
+	return filepath.Join(dir, filename)
+}
+
+// dirOf - Returns the directory of a resolved path, that the includes of the file are resolved
+// against. Includes of sources without a filename are resolved against Dir
+func (l *Loader) dirOf(resolved string) string {
+	if resolved == "" {
+		return l.Dir
+	}
+
+	if l.FS != nil {
+		return path.Dir(resolved)
+	}
+
+	return filepath.Dir(resolved)
+}
+
+// resolveRoot - Resolves the filename of a source given to the Loader against Dir. Sources
+// without a filename stay without one
+func (l *Loader) resolveRoot(filename string) string {
+	if filename == "" {
+		return ""
+	}
+
+	return l.resolvePath(l.Dir, filename)
+}
+
+// resolveInclude - Resolves the filename of an include against dir, the directory of the file
+// including it, or else against the first of IncludePaths it exists in. A glob pattern resolves
+// to every file it matches in the first directory it matches any in, in sorted order
+func (l *Loader) resolveInclude(dir, filename string) ([]string, error) {
+	searchDirs := append([]string{dir}, l.IncludePaths...)
+
+	if path.IsAbs(filename) || filepath.IsAbs(filename) {
+		searchDirs = searchDirs[:1]
+	}
+
+	isGlob := strings.ContainsAny(filename, "*?[")
+
+	for _, searchDir := range searchDirs {
+		resolved := l.resolvePath(searchDir, filename)
+
+		if !isGlob {
+			exists, err := l.exists(resolved)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if exists {
+				return []string{resolved}, nil
+			}
+
+			continue
+		}
+
+		matches, err := l.glob(resolved)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(matches) > 0 {
+			sort.Strings(matches)
+
+			return matches, nil
+		}
+	}
+
+	// A glob matching nothing includes nothing, a missing file is reported when it's read
+	if isGlob {
+		return nil, nil
+	}
+
+	return []string{l.resolvePath(dir, filename)}, nil
+}
+
+// exists - Reports whether there's a file at the resolved path. Errors other than the file not
+// existing, such as not being allowed to look, are returned instead of taken as a missing file
+func (l *Loader) exists(resolved string) (bool, error) {
+	var err error
+
+	if l.FS != nil {
+		_, err = fs.Stat(l.FS, resolved)
+	} else {
+		_, err = os.Stat(resolved)
+	}
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (l *Loader) glob(pattern string) ([]string, error) {
+	if l.FS != nil {
+		return fs.Glob(l.FS, pattern)
+	}
+
+	return filepath.Glob(pattern)
+}
+
+func (l *Loader) readFile(resolved string) ([]byte, error) {
+	if l.FS != nil {
+		return fs.ReadFile(l.FS, resolved)
+	}
+
+	return ioutil.ReadFile(resolved)
+}
+
+// parseOverrides - Parses the Overrides into entries to be added after every file
+func (l *load) parseOverrides() (entries []*Entry) {
+	for i, override := range l.Overrides {
+		// Every override is on a line of its own, so errors point at the one they're in
+		lines := strings.Repeat("\n", i)
+		pos := lexer.Position{Filename: "-set", Line: i + 1, Column: 1}
+		separator := strings.IndexByte(override, '=')
+
+		if separator < 0 {
+			l.errs.add(newPositionedError(SyntaxError, "", pos, "Override \""+override+"\" has to be written as path=value"))
+			continue
+		}
+
+		// Written as path:value, the override keeps the columns it was given with
+		path, text := override[:separator], override[separator+1:]
+		parsed, err := l.parse(strings.NewReader(lines+path+":"+text), pos.Filename)
+
+		if err != nil || !isSingleField(parsed) || parsed.Entries[0].Field.lastValue().isBareIdentifier() {
+			// Values that aren't .fig values, or are a single word, are taken as the string they are
+			if parsed, err = l.parse(strings.NewReader(lines+path+":\"\""), pos.Filename); err != nil {
+				l.errs.add(err)
+				continue
+			}
+
+			if !isSingleField(parsed) {
+				l.errs.add(newPositionedError(SyntaxError, "", pos, "Override \""+override+"\" has to be a single key path and value"))
+				continue
+			}
+
+			value := parsed.Entries[0].Field.lastValue()
+			value.String, value.literal = &text, true
+		}
+
+		entries = append(entries, l.parseIncludesAndAppendToConfig(*parsed, "").Entries...)
+	}
+
+	return
+}
+
+func isSingleField(c *FigureConfig) bool {
+	return len(c.Entries) == 1 && c.Entries[0].Field != nil && c.Entries[0].Field.Key != ""
+}
+
+// lastValue - Returns the value at the end of the key path of f
+func (f *Field) lastValue() *Value {
+	value := f.Value
+
+	for child := f.Child; child != nil; child = child.Child {
+		value = child.Value
+	}
+
+	return value
+}
+
+func (v *Value) isBareIdentifier() bool {
+	return v != nil && v.Identifier != nil && v.Operations == nil
+}
+
+// selectProfile - Returns the map of the profile in root, with the shared keys of root merged
+// in underneath it when ProfileShared is set
+func (l *load) selectProfile(root *OrderedMap, positions positionTable, rootPos lexer.Position) *OrderedMap {
+	value, exists := root.Get(l.Profile)
+
+	if !exists {
+		l.errs.add(newPositionedError(MissingKey, l.Profile, rootPos, "Profile \""+l.Profile+"\" isn't defined"))
+		return root
+	}
+
+	profile, isMap := value.(*OrderedMap)
+
+	if !isMap {
+		pos, _ := positions.lookup(value)
+		l.errs.add(newPositionedError(TypeConflict, l.Profile, pos, "Profile \""+l.Profile+"\" has to be a map"))
+		return root
+	}
+
+	if !l.ProfileShared {
+		return profile
+	}
+
+	shared := NewOrderedMap()
+
+	for _, key := range root.keys {
+		if _, isMap := root.values[key].(*OrderedMap); !isMap {
+			shared.define(key, root.values[key], root.origins[key])
+		}
+	}
+
+	mergeMapsOfInterface(shared, profile, positions)
+
+	pos, _ := positions.lookup(profile)
+	positions.record(shared, pos)
+
+	return shared
+}
+
+// Parse - Parses a .fig source read from r without transforming it. The filename is only
+// used for positions in errors
+func (l *Loader) Parse(r io.Reader, filename string) (*FigureConfig, error) {
+	ld, err := l.newLoad()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ld.parse(r, filename)
+}
+
+// Load - Parses and transforms a .fig source read from r. Errors are always an ErrorList
+func (l *Loader) Load(r io.Reader, filename string) (*Config, error) {
+	ld, err := l.newLoad()
+
+	if err != nil {
+		return nil, errorList(err)
+	}
+
+	parsed, err := ld.parse(r, filename)
+
+	if err != nil {
+		return nil, errorList(err)
+	}
+
+	return ld.transform(*parsed, l.resolveRoot(filename))
+}
+
+// LoadFile - Parses and transforms the .fig file with the given filename. Errors are always an
+// ErrorList, in which a file that can't be read is an IncludeFailure
+func (l *Loader) LoadFile(filename string) (*Config, error) {
+	return l.LoadFiles(filename)
+}
+
+// LoadFiles - Parses and transforms several .fig files as one configuration, in which later
+// files override earlier ones as if each file included the next at its end. Errors are always
+// an ErrorList, in which a file that can't be read is an IncludeFailure
+func (l *Loader) LoadFiles(filenames ...string) (*Config, error) {
+	if len(filenames) == 0 {
+		return nil, errorList(newPositionedError(IncludeFailure, "", lexer.Position{}, "No files to load"))
+	}
+
+	ld, err := l.newLoad()
+
+	if err != nil {
+		return nil, errorList(err)
+	}
+
+	layered := FigureConfig{}
+	readStdin := false
+
+	for i, filename := range filenames {
+		var resolved string
+		var parsed FigureConfig
+
+		if filename == "-" {
+			if readStdin {
+				return nil, errorList(newPositionedError(IncludeFailure, "", lexer.Position{Filename: "<stdin>"}, "Standard input can only be loaded once"))
+			}
+
+			readStdin = true
+			parsed, err = ld.parseStdin()
+		} else {
+			resolved = l.resolvePath(l.Dir, filename)
+			parsed, err = ld.parseFile(resolved)
+		}
+
+		if _, isConfigErr := err.(*ConfigError); err != nil && !isConfigErr {
+			// Files that can't be read are reported like includes that can't be
+			readErr := newPositionedError(IncludeFailure, "", lexer.Position{Filename: resolved}, err.Error())
+			readErr.Err = err
+			err = readErr
+		}
+
+		if err != nil {
+			return nil, errorList(err)
+		}
+
+		if i == 0 {
+			layered.Pos = parsed.Pos
+		}
+
+		// Each file resolves its includes against its own directory
+		if parsed = ld.parseIncludesAndAppendToConfig(parsed, resolved); ld.errs.full() {
+			return nil, ld.errs.err()
+		}
+
+		layered.Entries = append(layered.Entries, parsed.Entries...)
+	}
+
+	return ld.transformIncluded(layered)
+}
+
+// Transform - Transforms an already parsed configuration to a map. Includes are resolved
+// against the directory of the filename it was parsed with
+func (l *Loader) Transform(c FigureConfig) (*OrderedMap, error) {
+	ld, err := l.newLoad()
+
+	if err != nil {
+		return nil, errorList(err)
+	}
+
+	config, err := ld.transform(c, l.resolveRoot(c.Pos.Filename))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return config.root, nil
+}
+
+func (l *load) parse(r io.Reader, filename string) (*FigureConfig, error) {
+	config := &FigureConfig{}
+
+	if err := l.parser.Parse(namedReader{Reader: r, name: filename}, config); err != nil {
+		return nil, checkFileError(err, filename)
+	}
+
+	return config, nil
+}
+
+// readSource - Reads the file at an already resolved path. Files are only read once per load
+func (l *load) readSource(resolved string) ([]byte, error) {
+	source, exists := l.sources[resolved]
+
+	if !exists {
+		var err error
+
+		if source, err = l.readFile(resolved); err != nil {
+			return nil, err
+		}
+
+		l.sources[resolved] = source
+	}
+
+	return source, nil
+}
+
+// parseFile - Parses the .fig file at an already resolved path
+func (l *load) parseFile(resolved string) (FigureConfig, error) {
+	source, err := l.readSource(resolved)
+
+	if err != nil {
+		return FigureConfig{}, err
+	}
+
+	config, err := l.parse(bytes.NewReader(source), resolved)
+
+	if err != nil {
+		return FigureConfig{}, err
+	}
+
+	return *config, nil
+}
+
+// parseStdin - Parses the standard input, which has no directory of its own
+func (l *load) parseStdin() (FigureConfig, error) {
+	stdin := l.Stdin
+
+	if stdin == nil {
+		stdin = os.Stdin
+	}
+
+	config, err := l.parse(stdin, "<stdin>")
+
+	if err != nil {
+		return FigureConfig{}, err
+	}
+
+	return *config, nil
+}
+
+// parseIncludedFile - Parses the file at the resolved path brought in by include, either as a
+// .fig file or as a data file when the include names a data format or the extension of the file is one
+func (l *load) parseIncludedFile(include *Include, resolved string) (FigureConfig, error) {
+	format, err := l.dataFormat(include, resolved)
+
+	if err != nil {
+		return FigureConfig{}, err
+	}
+
+	if format == "" {
+		return l.parseFile(resolved)
+	}
+
+	source, err := l.readSource(resolved)
+
+	if err != nil {
+		return FigureConfig{}, err
+	}
+
+	data, err := l.decodeData(format, source)
+
+	if err != nil {
+		return FigureConfig{}, checkFileError(err, resolved)
+	}
+
+	pos := lexer.Position{Filename: resolved}
+	entries, err := dataToEntries(data, pos)
+
+	if err != nil {
+		return FigureConfig{}, err
+	}
+
+	return FigureConfig{Entries: entries, Pos: pos}, nil
+}
+
+// transform - Transforms c, parsed from the file at the resolved path
+func (l *load) transform(c FigureConfig, resolved string) (*Config, error) {
+	if c = l.parseIncludesAndAppendToConfig(c, resolved); l.errs.full() {
+		return nil, l.errs.err()
+	}
+
+	return l.transformIncluded(c)
+}
+
+// transformIncluded - Transforms a configuration whose includes have already been parsed
+func (l *load) transformIncluded(c FigureConfig) (*Config, error) {
+	errs := l.errs
+	rootPos := c.Pos
+
+	if c.Entries = append(c.Entries, l.parseOverrides()...); errs.full() {
+		return nil, errs.err()
+	}
+
+	if c.checkSectionRanges(errs); errs.full() {
+		return nil, errs.err()
+	}
+
+	c = c.explodeSectionsToFields()
+	c = c.childFieldsToMap()
+
+	if c.reverseIdentifiers(errs); errs.full() {
+		return nil, errs.err()
+	}
+
+	c = c.fieldsToArrays()
+
+	if c = c.mergeArrays(errs); errs.full() {
+		return nil, errs.err()
+	}
+
+	c = c.sequentialFieldsToArrays()
+
+	positions := positionTable{}
+	mapped := c.toMap(errs, positions)
+	positions.record(mapped, rootPos)
+
+	if l.Profile != "" && !errs.full() {
+		mapped = l.selectProfile(mapped, positions, rootPos)
+	}
+
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+
+	if l.OmitEmpty {
+		mapped.OmitEmpty()
+	}
+
+	if l.SortKeys {
+		mapped.SortKeys()
+	}
+
+	return &Config{root: mapped, positions: positions}, nil
+}
+
+// parseIncludesAndAppendToConfig - Replaces the includes of c, parsed from the file at the
+// resolved path, with the entries of the files they include
+func (l *load) parseIncludesAndAppendToConfig(c FigureConfig, resolved string) (ret FigureConfig) {
+	ret = FigureConfig{Pos: c.Pos}
+	ret.Entries = make([]*Entry, 0, len(c.Entries))
+
+	dir := l.dirOf(resolved)
+
+	c.Entries = l.resolveConditionals(c.Entries)
+	l.resolveEnv(c)
+
+	l.including = append(l.including, includingFile{resolved: resolved})
+	defer func() { l.including = l.including[:len(l.including)-1] }()
+
+	for _, entry := range c.Entries {
+		var entries []*Entry
+		var stop bool
+
+		switch {
+		case entry.Include != nil:
+			entries, stop = l.parseInclude(entry.Include, dir, nil)
+		case entry.Section != nil:
+			entries, stop = l.parseSectionIncludes(entry, dir)
+		default:
+			entries = []*Entry{entry}
+		}
+
+		ret.Entries = append(ret.Entries, entries...)
+
+		if stop {
+			return
+		}
+	}
+
+	return
+}
+
+// parseSectionIncludes - Splits the section of entry around its includes, which place the content
+// of the files they include under the roots of the section
+func (l *load) parseSectionIncludes(entry *Entry, dir string) (entries []*Entry, stop bool) {
+	section := entry.Section
+	entries = []*Entry{entry}
+
+	var rest *Section
+
+	for i, field := range section.Fields {
+		if field.Include == nil {
+			if rest != nil {
+				rest.Fields = append(rest.Fields, field)
+			}
+
+			continue
+		}
+
+		// Fields up until the first include stay in the section itself
+		if rest == nil {
+			entries[0] = &Entry{Pos: entry.Pos, Section: &Section{Roots: section.Roots, Fields: section.Fields[:i], Pos: section.Pos, includes: section.includes}}
+		}
+
+		included, stop := l.parseInclude(field.Include, dir, section.Roots)
+		entries = append(entries, included...)
+
+		if stop {
+			return entries, true
+		}
+
+		rest = &Section{Roots: section.Roots, Pos: section.Pos, includes: section.includes}
+		entries = append(entries, &Entry{Pos: entry.Pos, Section: rest})
+	}
+
+	return
+}
+
+// parseInclude - Parses the files of include, resolved against dir, and returns their entries.
+// With a mount path, or inside a section with the given roots, the entries are placed under them
+func (l *load) parseInclude(include *Include, dir string, roots []SectionRoot) (entries []*Entry, stop bool) {
+	var scope *includeScope
+
+	if include.Params != nil {
+		for _, param := range include.Params {
+			param.childFieldsToMap()
+		}
+
+		scope = &includeScope{params: include.Params}
+	}
+
+	for _, includeName := range include.Includes {
+		includePaths, err := l.resolveInclude(dir, includeName)
+
+		if err != nil {
+			if l.errs.add(checkConfigError(IncludeFailure, err, include, "")) {
+				return entries, true
+			}
+
+			continue
+		}
+
+		for _, includeResolved := range includePaths {
+			if include.Optional {
+				exists, err := l.exists(includeResolved)
+
+				if l.errs.add(checkConfigError(IncludeFailure, err, include, "")) {
+					return entries, true
+				}
+
+				if !exists {
+					continue
+				}
+			}
+
+			if err := l.followInclude(include, includeResolved); err != nil {
+				if l.errs.add(err) {
+					return entries, true
+				}
+
+				continue
+			}
+
+			newConfig, err := l.parseIncludedFile(include, includeResolved)
+
+			if err != nil {
+				if l.errs.add(checkConfigError(IncludeFailure, err, include, "")) {
+					return entries, true
+				}
+
+				continue
+			}
+
+			newConfig = l.parseIncludesAndAppendToConfig(newConfig, includeResolved)
+
+			for _, includedEntry := range newConfig.Entries {
+				includedEntry.includedAt(include.Pos)
+			}
+
+			if scope != nil {
+				for _, includedEntry := range newConfig.Entries {
+					includedEntry.scopedIn(scope)
+				}
+			}
+
+			entries = append(entries, newConfig.Entries...)
+
+			if l.errs.full() {
+				return entries, true
+			}
+		}
+	}
+
+	if include.Mount != nil {
+		roots = mountPathRoots(roots, include.Mount, include.Pos)
+	}
+
+	if roots != nil {
+		entries = mountEntries(entries, roots, include.Pos)
+	}
+
+	return
+}
+
+// followInclude - Checks that include may bring in the file at the resolved path, which it
+// may not when the file is already being included or when includes nest too deep
+func (l *load) followInclude(include *Include, resolved string) error {
+	l.including[len(l.including)-1].include = include
+
+	for i, file := range l.including {
+		if file.resolved == resolved {
+			return checkConfigError(IncludeCycle, errors.New("File includes itself: "+l.includeChain(i, resolved)), include, "")
+		}
+	}
+
+	if l.MaxIncludeDepth > 0 && len(l.including) > l.MaxIncludeDepth {
+		return checkConfigError(IncludeFailure, errors.New("Includes nest deeper than "+strconv.Itoa(l.MaxIncludeDepth)+" files: "+l.includeChain(0, resolved)), include, "")
+	}
+
+	return nil
+}
+
+// includeChain - Describes the includes followed from the file at index from to the file at
+// the resolved path, as in a.fig:3 -> b.fig:1 -> a.fig
+func (l *load) includeChain(from int, resolved string) string {
+	links := []string{}
+
+	for _, file := range l.including[from:] {
+		links = append(links, file.include.Pos.Filename+":"+strconv.Itoa(file.include.Pos.Line))
+	}
+
+	return strings.Join(append(links, resolved), " -> ")
+}
@@ -0,0 +1,790 @@
+package gofigure
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+func TestConcurrentLoads(t *testing.T) {
+	const loads = 16
+
+	dirs := make([]string, loads)
+	for i := range dirs {
+		dirs[i] = t.TempDir()
+
+		main := `%include "child.fig"` + "\nvalue: child.value"
+		child := `child.value: ` + strconv.Itoa(i)
+
+		if err := ioutil.WriteFile(filepath.Join(dirs[i], "main.fig"), []byte(main), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(dirs[i], "child.fig"), []byte(child), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i, dir := range dirs {
+		wg.Add(1)
+
+		go func(i int, dir string) {
+			defer wg.Done()
+
+			config, err := (&Loader{Dir: dir}).LoadFile("main.fig")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			value, err := config.Lookup("value")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			if integer, isInteger := value.(*int64); !isInteger || *integer != int64(i) {
+				t.Errorf("Load %d got value %v", i, value)
+			}
+		}(i, dir)
+	}
+
+	wg.Wait()
+}
+
+func TestLoadFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"conf/main.fig":           {Data: []byte(`%include "services/web.fig"` + "\nname: \"main\"")},
+		"conf/services/web.fig":   {Data: []byte(`%include "../shared.fig", "/conf/services/db.fig"` + "\nweb.port: 80")},
+		"conf/services/db.fig":    {Data: []byte(`db.port: 5432`)},
+		"conf/shared.fig":         {Data: []byte(`shared: true`)},
+		"conf/services/other.fig": {Data: []byte(`other: true`)},
+	}
+
+	config, err := (&Loader{FS: fsys}).LoadFile("conf/main.fig")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marshaled, err := config.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"shared":true,"db":{"port":5432},"web":{"port":80},"name":"main"}`
+	if string(marshaled) != expected {
+		t.Errorf("\nGot: %s\nExpected: %s", marshaled, expected)
+	}
+
+	if _, err := (&Loader{FS: fsys, Dir: "conf/services"}).LoadFile("main.fig"); err == nil {
+		t.Errorf("Expected an error when loading a file missing from Dir")
+	}
+
+	if _, err := (&Loader{FS: fsys, Dir: "conf/services"}).LoadFile("web.fig"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIncludeCycles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.fig":    {Data: []byte("aa: 1\n\n%include \"b.fig\"")},
+		"b.fig":    {Data: []byte("%include \"a.fig\"\nbb: 2")},
+		"self.fig": {Data: []byte(`%include "./self.fig"`)},
+		"1.fig":    {Data: []byte(`%include "2.fig"`)},
+		"2.fig":    {Data: []byte(`%include "3.fig"`)},
+		"3.fig":    {Data: []byte(`three: 3`)},
+	}
+
+	testCases := []struct {
+		filename string
+		loader   *Loader
+		kind     ErrorKind
+		expected string
+	}{
+		{"a.fig", &Loader{FS: fsys}, IncludeCycle, "b.fig:1:1: include cycle: File includes itself: a.fig:3 -> b.fig:1 -> a.fig"},
+		{"self.fig", &Loader{FS: fsys}, IncludeCycle, "self.fig:1:1: include cycle: File includes itself: self.fig:1 -> self.fig"},
+		{"1.fig", &Loader{FS: fsys, MaxIncludeDepth: 1}, IncludeFailure, "2.fig:1:1: include failure: Includes nest deeper than 1 files: 1.fig:1 -> 2.fig:1 -> 3.fig"},
+	}
+
+	for _, testCase := range testCases {
+		_, err := testCase.loader.LoadFile(testCase.filename)
+
+		errs, isErrorList := err.(ErrorList)
+		if !isErrorList || len(errs) != 1 {
+			t.Errorf("Expected one error loading %s, got: %v", testCase.filename, err)
+			continue
+		}
+
+		if errs[0].Kind != testCase.kind || errs[0].Error() != testCase.expected {
+			t.Errorf("\nGot: %s\nExpected: %s", errs[0], testCase.expected)
+		}
+	}
+
+	if _, err := (&Loader{FS: fsys, MaxIncludeDepth: 2}).LoadFile("1.fig"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIncludeSearchPathsAndGlobs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app/main.fig":           {Data: []byte(`%include "conf.d/*.fig", "shared.fig", "empty.d/*.fig"`)},
+		"app/conf.d/20-web.fig":  {Data: []byte(`services.web: true`)},
+		"app/conf.d/10-db.fig":   {Data: []byte(`services.db: true`)},
+		"app/conf.d/notes.txt":   {Data: []byte(`not included`)},
+		"lib/shared.fig":         {Data: []byte(`shared: "lib"`)},
+		"vendor/shared.fig":      {Data: []byte(`shared: "vendor"`)},
+		"vendor/conf.d/0-xx.fig": {Data: []byte(`services.vendor: true`)},
+	}
+
+	loader := &Loader{FS: fsys, IncludePaths: []string{"lib", "vendor"}}
+
+	config, err := loader.LoadFile("app/main.fig")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marshaled, err := config.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"services":{"db":true,"web":true},"shared":"lib"}`
+	if string(marshaled) != expected {
+		t.Errorf("\nGot: %s\nExpected: %s", marshaled, expected)
+	}
+
+	loader.IncludePaths = nil
+
+	_, err = loader.LoadFile("app/main.fig")
+
+	errs, isErrorList := err.(ErrorList)
+	if !isErrorList || len(errs) != 1 || errs[0].Kind != IncludeFailure {
+		t.Errorf("Expected an include failure for shared.fig without search paths, got: %v", err)
+	}
+}
+
+func TestOptionalIncludes(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.fig":    {Data: []byte("%include? \"local.fig\"\n%include? \"present.fig\"\nkey: \"main\"")},
+		"present.fig": {Data: []byte(`present: true`)},
+		"broken.fig":  {Data: []byte(`%include? "syntax.fig"`)},
+		"syntax.fig":  {Data: []byte(`key: ]`)},
+	}
+
+	config, err := (&Loader{FS: fsys}).LoadFile("main.fig")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marshaled, err := config.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"present":true,"key":"main"}`
+	if string(marshaled) != expected {
+		t.Errorf("\nGot: %s\nExpected: %s", marshaled, expected)
+	}
+
+	_, err = (&Loader{FS: fsys}).LoadFile("broken.fig")
+
+	errs, isErrorList := err.(ErrorList)
+	if !isErrorList || len(errs) != 1 || errs[0].Kind != SyntaxError || errs[0].Filename != "syntax.fig" {
+		t.Errorf("Expected a syntax error in syntax.fig, got: %v", err)
+	}
+
+	// Only files that don't exist are left out, not those that can't be looked at
+	_, err = (&Loader{FS: deniedFS{fsys, "present.fig"}}).LoadFile("main.fig")
+
+	errs, isErrorList = err.(ErrorList)
+	if !isErrorList || len(errs) != 1 || errs[0].Kind != IncludeFailure || errs[0].Line != 2 {
+		t.Errorf("Expected an include failure at main.fig:2, got: %v", err)
+	}
+}
+
+// deniedFS - A file system that isn't allowed to open one of its files
+type deniedFS struct {
+	fstest.MapFS
+	denied string
+}
+
+func (d deniedFS) Open(name string) (fs.File, error) {
+	if name == d.denied {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+
+	return d.MapFS.Open(name)
+}
+
+func (d deniedFS) Stat(name string) (fs.FileInfo, error) {
+	if name == d.denied {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrPermission}
+	}
+
+	return d.MapFS.Stat(name)
+}
+
+func TestMountedIncludes(t *testing.T) {
+	fsys := fstest.MapFS{
+		"postgres.fig": {Data: []byte("port: 5432\nuser: \"postgres\"\n[options]\nssl: true")},
+		"main.fig": {Data: []byte(`%include "postgres.fig" as database.primary
+[%{dev,prod}]
+name: "app"
+%include "postgres.fig" as database
+%include "postgres.fig"
+debug: false`)},
+		"map.fig": {Data: []byte(`key: { %include "postgres.fig" }`)},
+	}
+
+	config, err := (&Loader{FS: fsys}).LoadFile("main.fig")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marshaled, err := config.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	database := `{"port":5432,"user":"postgres","options":{"ssl":true}}`
+	root := `{"name":"app","database":` + database + `,"port":5432,"user":"postgres","options":{"ssl":true},"debug":false}`
+	expected := `{"database":{"primary":` + database + `},"dev":` + root + `,"prod":` + root + `}`
+	if string(marshaled) != expected {
+		t.Errorf("\nGot: %s\nExpected: %s", marshaled, expected)
+	}
+
+	origins, err := config.Explain("prod.database.options.ssl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(origins) != 1 || origins[0].Pos.Filename != "postgres.fig" || len(origins[0].Includes) != 1 || origins[0].Includes[0].Line != 4 {
+		t.Errorf("Expected ssl to come from postgres.fig, included at line 4, got: %v", origins)
+	}
+
+	_, err = (&Loader{FS: fsys}).LoadFile("map.fig")
+
+	errs, isErrorList := err.(ErrorList)
+	if !isErrorList || len(errs) != 1 || errs[0].Kind != SyntaxError {
+		t.Errorf("Expected a syntax error for an include inside a map, got: %v", err)
+	}
+}
+
+func TestParameterisedIncludes(t *testing.T) {
+	fsys := fstest.MapFS{
+		"service.fig": {Data: []byte("name: svc_name\nport: svc_port\nurl: { port: svc_port }\nlabels: [svc_name, \"service\"]\nnested.key: svc_port\nab.cd: \"${svc_name}\"\n[extra]\naa.bb: svc_name")},
+		"wrapper.fig": {Data: []byte(`%include "service.fig" as inner with { svc_name: outer_name, svc_port: 1 }`)},
+		"main.fig": {Data: []byte(`svc_name: "global"
+default_port: 80
+%include "service.fig" as billing with { svc_name: "billing" svc_port: 8080 }
+%include "service.fig" as web with { svc_name: "web", svc_port: default_port }
+%include "wrapper.fig" as wrapped with { outer_name: "nested" }`)},
+	}
+
+	config, err := (&Loader{FS: fsys}).LoadFile("main.fig")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marshaled, err := config.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"svc_name":"global","default_port":80,` +
+		`"billing":{"name":"billing","port":8080,"url":{"port":8080},"labels":["billing","service"],"nested":{"key":8080},"ab":{"cd":"billing"},"extra":{"aa":{"bb":"billing"}}},` +
+		`"web":{"name":"web","port":80,"url":{"port":80},"labels":["web","service"],"nested":{"key":80},"ab":{"cd":"web"},"extra":{"aa":{"bb":"web"}}},` +
+		`"wrapped":{"inner":{"name":"nested","port":1,"url":{"port":1},"labels":["nested","service"],"nested":{"key":1},"ab":{"cd":"nested"},"extra":{"aa":{"bb":"nested"}}}}}`
+	if string(marshaled) != expected {
+		t.Errorf("\nGot: %s\nExpected: %s", marshaled, expected)
+	}
+}
+
+func TestDataIncludes(t *testing.T) {
+	fsys := fstest.MapFS{
+		"generated.json": {Data: []byte(`{"zz": {"host": "db", "port": 5432, "ratio": 0.5, "tags": ["a", null], "empty": {}, "none": null}, "aa": true}`)},
+		"data.txt":       {Data: []byte(`{"from_txt": 1}`)},
+		"list.json":      {Data: []byte(`[1, 2]`)},
+		"broken.json":    {Data: []byte(`{"key": }`)},
+		"values.yml": {Data: []byte(`defaults: &defaults
+  timeout: 30
+  retries: 3
+yaml_b: 2
+yaml_a:
+  - x
+  - <<: *defaults
+    retries: 5
+`)},
+		"settings.toml": {Data: []byte(`toml_b = "b"
+toml_a = 1.5
+
+[server]
+port = 8080
+host = "localhost"
+
+[[server.routes]]
+path = "/"
+`)},
+		"broken.yaml": {Data: []byte("key: [")},
+		"broken.toml": {Data: []byte("key = ")},
+		"main.fig": {Data: []byte(`[prod]
+%include "generated.json"
+[]
+%include JSON "data.txt"
+[@.zz]
+port: 6543
+copied: prod.zz.host`)},
+	}
+
+	config, err := (&Loader{FS: fsys}).LoadFile("main.fig")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marshaled, err := config.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"prod":{"zz":{"host":"db","port":6543,"ratio":0.5,"tags":["a",null],"empty":{},"none":null,"copied":"db"},"aa":true},"from_txt":1}`
+	if string(marshaled) != expected {
+		t.Errorf("\nGot: %s\nExpected: %s", marshaled, expected)
+	}
+
+	firstConfig := config
+
+	// Format names are matched like extensions, in any case and with yml for yaml
+	config, err = (&Loader{FS: fsys}).Load(strings.NewReader("%include yml \"values.yml\"\n%include \"settings.toml\""), "test.fig")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if marshaled, err = config.MarshalJSON(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected = `{"defaults":{"timeout":30,"retries":3},"yaml_b":2,"yaml_a":["x",{"timeout":30,"retries":5}],` +
+		`"toml_b":"b","toml_a":1.5,"server":{"port":8080,"host":"localhost","routes":[{"path":"/"}]}}`
+	if string(marshaled) != expected {
+		t.Errorf("\nGot: %s\nExpected: %s", marshaled, expected)
+	}
+
+	// Keys from JSON and YAML have their line, keys from TOML only their file
+	positions := []struct {
+		config *Config
+		path   string
+		pos    string
+	}{
+		{config, "yaml_b", "values.yml:4:1"},
+		{config, "defaults.retries", "values.yml:3:3"},
+		{config, "toml_b", "settings.toml:0:0"},
+		{firstConfig, "prod.zz.ratio", "generated.json:1:37"},
+		{firstConfig, "from_txt", "data.txt:1:2"},
+	}
+
+	for _, expected := range positions {
+		origins, err := expected.config.Explain(expected.path)
+		if err != nil || len(origins) == 0 || origins[0].Pos.String() != expected.pos {
+			t.Errorf("Expected %s to be defined at %s, got: %v %v", expected.path, expected.pos, origins, err)
+		}
+	}
+
+	// DataFormats replace the built in decoders of the same name
+	yaml := func(data []byte) (interface{}, error) {
+		return map[string]interface{}{"yaml_b": uint8(2), "yaml_a": []string{"x"}}, nil
+	}
+
+	config, err = (&Loader{FS: fsys, DataFormats: map[string]DataDecoder{"yaml": yaml}}).Load(strings.NewReader(`%include "values.yml"`), "test.fig")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if marshaled, _ = config.MarshalJSON(); string(marshaled) != `{"yaml_a":["x"],"yaml_b":2}` {
+		t.Errorf("Expected the decoder from DataFormats to be used, got: %s", marshaled)
+	}
+
+	testCases := []struct {
+		data string
+		kind ErrorKind
+	}{
+		{`%include "list.json"`, IncludeFailure},
+		{`%include "broken.json"`, SyntaxError},
+		{`%include "broken.yaml"`, SyntaxError},
+		{`%include "broken.toml"`, SyntaxError},
+		{`%include ini "data.txt"`, IncludeFailure},
+	}
+
+	for _, testCase := range testCases {
+		_, err := (&Loader{FS: fsys}).Load(strings.NewReader(testCase.data), "test.fig")
+
+		errs, isErrorList := err.(ErrorList)
+		if !isErrorList || len(errs) != 1 || errs[0].Kind != testCase.kind {
+			t.Errorf("Expected one %s from %s, got: %v", testCase.kind, testCase.data, err)
+		}
+	}
+}
+
+func TestEnvValues(t *testing.T) {
+	env := map[string]string{"DB_HOST": "db", "EMPTY": "", "NESTED": "${env:DB_HOST}"}
+	lookupEnv := func(name string) (string, bool) {
+		value, exists := env[name]
+		return value, exists
+	}
+
+	data := `host: env("DB_HOST")
+port: env("DB_PORT", "5432")
+url: "postgres://${env:DB_HOST}:${env:DB_PORT:-5432}/${env:EMPTY:-main}"
+nested: env("NESTED")
+escaped: "$${env:DB_HOST}"
+list: [env("DB_HOST"), {user: env("DB_USER", "admin")}]`
+
+	config, err := (&Loader{LookupEnv: lookupEnv}).Load(strings.NewReader(data), "test.fig")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marshaled, err := config.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"host":"db","port":"5432","url":"postgres://db:5432/main","nested":"${env:DB_HOST}","escaped":"${env:DB_HOST}","list":["db",{"user":"admin"}]}`
+	if string(marshaled) != expected {
+		t.Errorf("\nGot: %s\nExpected: %s", marshaled, expected)
+	}
+
+	testCases := []struct {
+		loader *Loader
+		data   string
+		line   int
+	}{
+		{&Loader{LookupEnv: lookupEnv}, "host: env(\"DB_HOST\")\npassword: env(\"DB_PASSWORD\")", 2},
+		{&Loader{LookupEnv: lookupEnv}, `url: "${env:DB_PASSWORD}"`, 1},
+		{&Loader{LookupEnv: lookupEnv, DisableEnv: true}, `host: env("DB_HOST")`, 1},
+	}
+
+	for _, testCase := range testCases {
+		_, err := testCase.loader.Load(strings.NewReader(testCase.data), "test.fig")
+
+		errs, isErrorList := err.(ErrorList)
+		if !isErrorList || len(errs) != 1 || errs[0].Kind != UnresolvedIdentifier || errs[0].Line != testCase.line {
+			t.Errorf("Expected one %s on line %d from %s, got: %v", UnresolvedIdentifier, testCase.line, testCase.data, err)
+		}
+	}
+
+	config, err = (&Loader{LookupEnv: lookupEnv, DisableEnv: true}).Load(strings.NewReader(`port: env("DB_HOST", "fallback")`), "test.fig")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if port, _ := config.Lookup("port"); plainScalar(port) != "fallback" {
+		t.Errorf("Expected the default with the environment disabled, got: %v", plainScalar(port))
+	}
+}
+
+func TestConditionals(t *testing.T) {
+	fsys := fstest.MapFS{
+		"prod.fig": {Data: []byte(`replicas: 3`)},
+		"main.fig": {Data: []byte(`%if profile == "production" {
+  %include "prod.fig"
+  [database]
+  host: "db.prod"
+} %else %if profile == "staging" {
+  [database]
+  host: "db.staging"
+} %else {
+  [database]
+  host: "localhost"
+}
+
+[server]
+port: 8080
+%if debug {
+  verbose: true
+  %include? "missing.fig"
+}
+limits: { %if profile != "production" { max: 10 } min: 1 }`)},
+	}
+
+	testCases := []struct {
+		defines  map[string]string
+		expected string
+	}{
+		{map[string]string{"profile": "production"}, `{"replicas":3,"database":{"host":"db.prod"},"server":{"port":8080,"limits":{"min":1}}}`},
+		{map[string]string{"profile": "staging", "debug": "true"}, `{"database":{"host":"db.staging"},"server":{"port":8080,"verbose":true,"limits":{"max":10,"min":1}}}`},
+		{map[string]string{"debug": "false"}, `{"database":{"host":"localhost"},"server":{"port":8080,"limits":{"max":10,"min":1}}}`},
+	}
+
+	for _, testCase := range testCases {
+		config, err := (&Loader{FS: fsys, Defines: testCase.defines}).LoadFile("main.fig")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		marshaled, err := config.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(marshaled) != testCase.expected {
+			t.Errorf("\nGot: %s\nExpected: %s\nWith: %v", marshaled, testCase.expected, testCase.defines)
+		}
+	}
+
+	// The branch that isn't taken is never resolved
+	_, err := (&Loader{}).Load(strings.NewReader(`%if missing { key: env("NOT_SET_ANYWHERE") %include "missing.fig" }`), "test.fig")
+	if err != nil {
+		t.Errorf("Expected the branch not taken to be ignored, got: %v", err)
+	}
+
+	_, err = (&Loader{Defines: map[string]string{"debug": "1"}}).Load(strings.NewReader("[server]\n%if debug { [other] }"), "test.fig")
+
+	errs, isErrorList := err.(ErrorList)
+	if !isErrorList || len(errs) != 1 || errs[0].Kind != SyntaxError || errs[0].Line != 2 {
+		t.Errorf("Expected a syntax error for a section in a conditional inside a section, got: %v", err)
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	data := `name: "service"
+workers: 2
+[%{dev,production}]
+locale: "en_US"
+[production]
+workers: 8
+%if profile == "production" {
+  replicas: 3
+}`
+
+	testCases := []struct {
+		loader   *Loader
+		expected string
+	}{
+		{&Loader{Profile: "production"}, `{"locale":"en_US","workers":8,"replicas":3}`},
+		{&Loader{Profile: "production", ProfileShared: true}, `{"name":"service","workers":8,"locale":"en_US","replicas":3}`},
+		{&Loader{Profile: "dev", ProfileShared: true}, `{"name":"service","workers":2,"locale":"en_US"}`},
+		{&Loader{Profile: "production", Defines: map[string]string{"profile": "dev"}}, `{"locale":"en_US","workers":8}`},
+	}
+
+	for _, testCase := range testCases {
+		config, err := testCase.loader.Load(strings.NewReader(data), "test.fig")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		marshaled, err := config.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(marshaled) != testCase.expected {
+			t.Errorf("\nGot: %s\nExpected: %s\nWith profile: %s", marshaled, testCase.expected, testCase.loader.Profile)
+		}
+	}
+
+	config, err := (&Loader{Profile: "production", ProfileShared: true}).Load(strings.NewReader(data), "test.fig")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if origins, err := config.Explain("workers"); err != nil || len(origins) != 2 || origins[1].Pos.Line != 6 {
+		t.Errorf("Expected workers to be overridden on line 6, got: %v %v", origins, err)
+	}
+
+	errorCases := []struct {
+		profile string
+		kind    ErrorKind
+	}{
+		{"staging", MissingKey},
+		{"name", TypeConflict},
+	}
+
+	for _, errorCase := range errorCases {
+		_, err := (&Loader{Profile: errorCase.profile}).Load(strings.NewReader(data), "test.fig")
+
+		errs, isErrorList := err.(ErrorList)
+		if !isErrorList || len(errs) != 1 || errs[0].Kind != errorCase.kind {
+			t.Errorf("Expected one %s for profile %s, got: %v", errorCase.kind, errorCase.profile, err)
+		}
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	data := `workers: 2
+[production.database.%{master,slave}]
+host: "db"
+port: 5432`
+
+	loader := &Loader{Overrides: []string{
+		"production.database.master.host=10.0.0.5",
+		"workers=8",
+		"production.database.slave={ port: production.database.master.port + 1 tls: true }",
+		"tags=[\"a\", 1.5]",
+		"workers=16",
+		"region=eu-west",
+		"label=\"quoted\"",
+		"empty=",
+	}}
+
+	config, err := loader.Load(strings.NewReader(data), "test.fig")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marshaled, err := config.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"workers":16,"production":{"database":{"master":{"host":"10.0.0.5","port":5432},"slave":{"host":"db","port":5433,"tls":true}}},"tags":["a",1.5],"region":"eu-west","label":"quoted","empty":""}`
+	if string(marshaled) != expected {
+		t.Errorf("\nGot: %s\nExpected: %s", marshaled, expected)
+	}
+
+	if origins, err := config.Explain("workers"); err != nil || len(origins) != 3 || origins[2].Pos.Filename != "-set" {
+		t.Errorf("Expected workers to be overridden by -set, got: %v %v", origins, err)
+	}
+
+	// Errors are reported on the line of the override they're in
+	for _, overrides := range [][]string{{"workers"}, {"workers=1", ".bad=1"}, {"workers=1", "workers=2", "total=workers + missing"}} {
+		_, err := (&Loader{Overrides: overrides}).Load(strings.NewReader(data), "test.fig")
+
+		errs, isErrorList := err.(ErrorList)
+		if !isErrorList || len(errs) != 1 || errs[0].Filename != "-set" || errs[0].Line != len(overrides) {
+			t.Errorf("Expected one error on line %d of -set from %v, got: %v", len(overrides), overrides, err)
+		}
+	}
+}
+
+func TestLoadFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"base.fig":         {Data: []byte("workers: 2\n[database]\nhost: \"localhost\"\nport: 5432")},
+		"site/site.fig":    {Data: []byte("%include \"shared.fig\"\n[database]\nhost: \"db.site\"")},
+		"site/shared.fig":  {Data: []byte(`region: "eu"`)},
+		"local.fig":        {Data: []byte(`workers: 8 url: "${region}.example.com:${database.port}"`)},
+		"missing_dep.fig":  {Data: []byte(`key: undefined_key`)},
+		"syntax_error.fig": {Data: []byte(`key: ]`)},
+	}
+
+	loader := &Loader{FS: fsys}
+
+	config, err := loader.LoadFiles("base.fig", "site/site.fig", "local.fig")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marshaled, err := config.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"workers":8,"database":{"host":"db.site","port":5432},"region":"eu","url":"eu.example.com:5432"}`
+	if string(marshaled) != expected {
+		t.Errorf("\nGot: %s\nExpected: %s", marshaled, expected)
+	}
+
+	if origins, err := config.Explain("database.host"); err != nil || len(origins) != 2 || origins[1].Pos.Filename != "site/site.fig" {
+		t.Errorf("Expected database.host to be overridden in site/site.fig, got: %v %v", origins, err)
+	}
+
+	// Every error is an ErrorList, whether it's in a file or the file can't be read at all
+	testCases := []struct {
+		filenames []string
+		kind      ErrorKind
+		filename  string
+	}{
+		{nil, IncludeFailure, ""},
+		{[]string{"base.fig", "missing_dep.fig"}, UnresolvedIdentifier, "missing_dep.fig"},
+		{[]string{"base.fig", "syntax_error.fig"}, SyntaxError, "syntax_error.fig"},
+		{[]string{"base.fig", "does_not_exist.fig"}, IncludeFailure, "does_not_exist.fig"},
+	}
+
+	for _, testCase := range testCases {
+		_, err := loader.LoadFiles(testCase.filenames...)
+
+		errs, isErrorList := err.(ErrorList)
+		if !isErrorList || len(errs) != 1 || errs[0].Kind != testCase.kind || errs[0].Filename != testCase.filename {
+			t.Errorf("Expected one %s in %q from %v, got: %v", testCase.kind, testCase.filename, testCase.filenames, err)
+		}
+	}
+
+	if _, err := loader.LoadFiles("does_not_exist.fig"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected the error for a missing file to wrap fs.ErrNotExist, got: %v", err)
+	}
+}
+
+func TestLoadStdin(t *testing.T) {
+	fsys := fstest.MapFS{
+		"conf/base.fig":   {Data: []byte(`workers: 2 region: "eu"`)},
+		"conf/shared.fig": {Data: []byte(`shared: true`)},
+		"lib/lib.fig":     {Data: []byte(`lib: 1`)},
+	}
+
+	loader := &Loader{
+		FS:           fsys,
+		Dir:          "conf",
+		IncludePaths: []string{"lib"},
+		Stdin:        strings.NewReader(`%include "shared.fig" %include "lib.fig" workers: 4`),
+	}
+
+	config, err := loader.LoadFiles("base.fig", "-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marshaled, err := config.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"workers":4,"region":"eu","shared":true,"lib":1}`
+	if string(marshaled) != expected {
+		t.Errorf("\nGot: %s\nExpected: %s", marshaled, expected)
+	}
+
+	if origins, err := config.Explain("workers"); err != nil || len(origins) != 2 || origins[1].Pos.Filename != "<stdin>" {
+		t.Errorf("Expected workers to be overridden in <stdin>, got: %v %v", origins, err)
+	}
+
+	_, err = (&Loader{Stdin: strings.NewReader("")}).LoadFiles("-", "-")
+
+	if errs, isErrorList := err.(ErrorList); !isErrorList || len(errs) != 1 || errs[0].Kind != IncludeFailure {
+		t.Errorf("Expected an include failure when loading the standard input twice, got: %v", err)
+	}
+}
+
+func TestOmitEmpty(t *testing.T) {
+	data := `bare
+explicit: null
+map: {}
+array: []
+kept: ""
+nested: { only_null: null, inner: { list: [] } }
+list: [null, {}, { key: null }]
+[root]
+[server]
+port: 8080
+host: null`
+
+	config, err := (&Loader{OmitEmpty: true}).Load(strings.NewReader(data), "test.fig")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marshaled, err := config.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"kept":"","list":[null,{},{}],"server":{"port":8080}}`
+	if string(marshaled) != expected {
+		t.Errorf("\nGot: %s\nExpected: %s", marshaled, expected)
+	}
+}
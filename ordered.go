@@ -0,0 +1,198 @@
+package gofigure
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+)
+
+// OrderedMap - A map that remembers the order its keys were first set in. Transformed
+// configurations use it for every map, so output keeps the key order of the .fig sources
+type OrderedMap struct {
+	keys   []string
+	values map[string]interface{}
+
+	// origins holds, for every key, where it was defined and overridden
+	origins map[string][]Origin
+}
+
+// NewOrderedMap - Returns an empty OrderedMap
+func NewOrderedMap() *OrderedMap {
+	return &OrderedMap{values: map[string]interface{}{}}
+}
+
+// Get - Returns the value set for key, and whether there is one
+func (m *OrderedMap) Get(key string) (interface{}, bool) {
+	value, exists := m.values[key]
+
+	return value, exists
+}
+
+// Set - Sets the value of key. A new key is placed last, an existing one keeps its place
+func (m *OrderedMap) Set(key string, value interface{}) {
+	if _, exists := m.values[key]; !exists {
+		m.keys = append(m.keys, key)
+	}
+
+	m.values[key] = value
+}
+
+// define - Sets the value of key and adds where it was defined to its origins
+func (m *OrderedMap) define(key string, value interface{}, origins []Origin) {
+	m.Set(key, value)
+	m.addOrigins(key, origins)
+}
+
+func (m *OrderedMap) addOrigins(key string, origins []Origin) {
+	if len(origins) == 0 {
+		return
+	}
+
+	if m.origins == nil {
+		m.origins = map[string][]Origin{}
+	}
+
+	m.origins[key] = append(m.origins[key], origins...)
+}
+
+// Origins - Returns every place in the .fig sources that defined or overrode key, oldest first.
+// The last Origin is the one whose value the key has
+func (m *OrderedMap) Origins(key string) []Origin {
+	return append([]Origin{}, m.origins[key]...)
+}
+
+// Delete - Removes key from the map
+func (m *OrderedMap) Delete(key string) {
+	if _, exists := m.values[key]; !exists {
+		return
+	}
+
+	delete(m.values, key)
+	delete(m.origins, key)
+
+	for i, existing := range m.keys {
+		if existing == key {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// Keys - Returns the keys of the map in order
+func (m *OrderedMap) Keys() []string {
+	return append([]string{}, m.keys...)
+}
+
+// Len - Returns the number of keys in the map
+func (m *OrderedMap) Len() int {
+	return len(m.keys)
+}
+
+// SortKeys - Sorts the keys of the map, and of every map nested in it, alphabetically
+func (m *OrderedMap) SortKeys() {
+	sort.Strings(m.keys)
+
+	for _, value := range m.values {
+		sortNestedKeys(value)
+	}
+}
+
+func sortNestedKeys(value interface{}) {
+	switch value.(type) {
+	case *OrderedMap:
+		value.(*OrderedMap).SortKeys()
+	case []interface{}:
+		for _, element := range value.([]interface{}) {
+			sortNestedKeys(element)
+		}
+	}
+}
+
+// OmitEmpty - Removes the keys whose values are null, empty maps or empty arrays from the map
+// and every map nested in it. Maps left empty that way are removed as well, while elements of
+// arrays are kept so the indices of the others don't change
+func (m *OrderedMap) OmitEmpty() {
+	for _, key := range m.Keys() {
+		if omitNestedEmpty(m.values[key]) {
+			m.Delete(key)
+		}
+	}
+}
+
+// omitNestedEmpty - Omits the empty values nested in value, and reports whether value is empty
+func omitNestedEmpty(value interface{}) bool {
+	switch value.(type) {
+	case nil:
+		return true
+	case *OrderedMap:
+		value.(*OrderedMap).OmitEmpty()
+
+		return value.(*OrderedMap).Len() == 0
+	case []interface{}:
+		for _, element := range value.([]interface{}) {
+			omitNestedEmpty(element)
+		}
+
+		return len(value.([]interface{})) == 0
+	}
+
+	return false
+}
+
+// ToMap - Returns the map, and every map nested in it, as a plain map[string]interface{}
+func (m *OrderedMap) ToMap() map[string]interface{} {
+	plain := make(map[string]interface{}, len(m.keys))
+
+	for key, value := range m.values {
+		plain[key] = toPlainMaps(value)
+	}
+
+	return plain
+}
+
+func toPlainMaps(value interface{}) interface{} {
+	switch value.(type) {
+	case *OrderedMap:
+		return value.(*OrderedMap).ToMap()
+	case []interface{}:
+		list := make([]interface{}, len(value.([]interface{})))
+
+		for i, element := range value.([]interface{}) {
+			list[i] = toPlainMaps(element)
+		}
+
+		return list
+	}
+
+	return value
+}
+
+// MarshalJSON - Marshals the map as a JSON object with its keys in order
+func (m *OrderedMap) MarshalJSON() ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	buffer.WriteByte('{')
+
+	for i, key := range m.keys {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+
+		marshaledKey, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+
+		marshaledValue, err := json.Marshal(m.values[key])
+		if err != nil {
+			return nil, err
+		}
+
+		buffer.Write(marshaledKey)
+		buffer.WriteByte(':')
+		buffer.Write(marshaledValue)
+	}
+
+	buffer.WriteByte('}')
+
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,104 @@
+package gofigure
+
+import (
+	"github.com/alecthomas/participle/lexer"
+)
+
+// Origin - A place in the .fig sources where a key was defined or overridden
+type Origin struct {
+	// Pos is the position of the key, or of the section root that created it
+	Pos lexer.Position
+
+	// Section is the position of the header of the section the key was defined in, if any
+	Section *lexer.Position
+
+	// Includes are the positions of the %include statements that brought the file of Pos into
+	// the configuration, outermost first
+	Includes []lexer.Position
+}
+
+func (o Origin) String() string {
+	str := o.Pos.String()
+
+	if o.Section != nil {
+		str += " in section " + o.Section.String()
+	}
+
+	for i := len(o.Includes) - 1; i >= 0; i-- {
+		str += ", included from " + o.Includes[i].String()
+	}
+
+	return str
+}
+
+// fieldSource - Where a field comes from, beyond its own position. It's filled in while
+// transforming and carried along every time a stage copies the field
+type fieldSource struct {
+	section  *lexer.Position
+	includes []lexer.Position
+
+	// scope holds the parameters of the includes that brought the field in
+	scope *includeScope
+
+	// chain holds every origin of the field when it replaced earlier fields of the same key
+	chain []Origin
+}
+
+// inherit - Fills in the section and includes of a field nested in a field from parent
+func (s *fieldSource) inherit(parent fieldSource) {
+	if s.section == nil {
+		s.section = parent.section
+	}
+
+	if s.includes == nil {
+		s.includes = parent.includes
+	}
+
+	if s.scope == nil {
+		s.scope = parent.scope
+	}
+}
+
+// origins - Returns the chain of places that defined the field, oldest first
+func (f *Field) origins() []Origin {
+	if f.source.chain != nil {
+		return append([]Origin{}, f.source.chain...)
+	}
+
+	return []Origin{{Pos: f.Pos, Section: f.source.section, Includes: f.source.includes}}
+}
+
+// scopedIn - Records that the entry was brought in by an include passing the parameters of scope
+func (e *Entry) scopedIn(scope *includeScope) {
+	if e.Field != nil {
+		e.Field.source.scope = linkScope(e.Field.source.scope, scope)
+	}
+
+	if e.Section != nil {
+		e.Section.scope = linkScope(e.Section.scope, scope)
+
+		for _, field := range e.Section.Fields {
+			if field.source.scope != nil {
+				field.source.scope = linkScope(field.source.scope, scope)
+			}
+		}
+	}
+}
+
+// includedAt - Records that the entry was brought in by the %include statement at pos
+func (e *Entry) includedAt(pos lexer.Position) {
+	if e.Field != nil {
+		e.Field.source.includes = append([]lexer.Position{pos}, e.Field.source.includes...)
+	}
+
+	if e.Section != nil {
+		e.Section.includes = append([]lexer.Position{pos}, e.Section.includes...)
+
+		// Fields of a mounted include keep their own includes, the rest take those of the section
+		for _, field := range e.Section.Fields {
+			if field.source.includes != nil {
+				field.source.includes = append([]lexer.Position{pos}, field.source.includes...)
+			}
+		}
+	}
+}
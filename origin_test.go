@@ -0,0 +1,67 @@
+package gofigure
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	dir := t.TempDir()
+
+	main := "%include \"databases.fig\"\n" +
+		"[production.database.@]\n" +
+		"password: 12345\n" +
+		"servers: [\"a\", \"b\"]"
+	databases := "[production.database.%{master,slave}]\n" +
+		"password: \"root\""
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "main.fig"), []byte(main), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "databases.fig"), []byte(databases), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := (&Loader{Dir: dir}).LoadFile("main.fig")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	origins, err := config.Explain("production.database.slave.password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mainFile := filepath.Join(dir, "main.fig")
+	databasesFile := filepath.Join(dir, "databases.fig")
+
+	expected := []string{
+		databasesFile + ":2:1 in section " + databasesFile + ":1:1, included from " + mainFile + ":1:1",
+		mainFile + ":3:1 in section " + mainFile + ":2:1",
+	}
+
+	if len(origins) != len(expected) {
+		t.Fatalf("Got origins: %v, expected: %v", origins, expected)
+	}
+
+	for i, origin := range origins {
+		if origin.String() != expected[i] {
+			t.Errorf("\nGot: %s\nExpected: %s", origin, expected[i])
+		}
+	}
+
+	origins, err = config.Explain("production.database.master.servers.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(origins) != 1 || origins[0].Pos.Line != 4 || origins[0].Pos.Column != 16 {
+		t.Errorf("Got origins: %v, expected one at line 4, column 16", origins)
+	}
+
+	if _, err := config.Explain("production.database.missing"); err == nil {
+		t.Errorf("Expected an error when explaining a missing key")
+	}
+}
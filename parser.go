@@ -1,8 +1,7 @@
-package main
+package gofigure
 
 import (
 	"os"
-	"strings"
 
 	"github.com/alecthomas/participle"
 	"github.com/alecthomas/participle/lexer"
@@ -25,9 +24,11 @@ var GoFigureLexer = lexer.Must(lexer.Regexp(
 		`|(?P<Float>-?\d+\.\d+)` +
 		`|(?P<Int>-?\d+)` +
 		`|(?P<SectionEnd>\[\])` +
-		`|(?P<Include>%include)` +
+		`|(?P<Include>%include\??)` +
+		`|(?P<Directive>%if|%else)` +
+		`|(?P<Compare>[=!]=)` +
 		`|(?P<Expand>\.\.\.)` +
-		`|(?P<Special>[][{}.,:%@])`,
+		`|(?P<Special>[][{}.,:%@()+*/-])`,
 ))
 
 // FigureConfig - Structure capable of containing a full GoFigure configuration
@@ -38,14 +39,44 @@ type FigureConfig struct {
 }
 
 type Entry struct {
-	Include *Include `@@`
-	Section *Section `| "[" @@ (SectionEnd|EOF)?`
-	Field   *Field   `| @@`
-	Pos     lexer.Position
+	Include     *Include     `@@`
+	Conditional *Conditional `| @@`
+	Section     *Section     `| "[" @@ (SectionEnd|EOF)?`
+	Field       *Field       `| @@`
+	Pos         lexer.Position
 }
 
 type Include struct {
-	Includes []string `"%include" @String (","? @String)* `
+	// Optional includes, written %include?, skip files that don't exist
+	Optional bool `("%include" | @"%include?")`
+	// Format, as in %include json "file.json", includes data files instead of .fig files
+	Format   string   `@Ident?`
+	Includes []string `@String (","? @String)* `
+	// Mount, written as a.b after the filenames, places the content of the included files under a key path
+	Mount []string `("as" @(Ident|String) ("." @(Ident|String|Int))*)?`
+	// Params, written with { key: value }, are visible as identifiers inside the included files
+	Params []*Field `("with" "{" (@@ ","?)* "}")?`
+
+	Pos lexer.Position
+}
+
+// Conditional - Entries that are only used when a condition on the defined variables holds, as in
+// %if profile == "production" { ... } %else { ... }
+type Conditional struct {
+	Condition *Condition `"%if" @@`
+	Then      []*Entry   `"{" (@@)* "}"`
+	// ElseIf chains another condition, written as %else %if
+	ElseIf *Conditional `("%else" ( @@`
+	Else   []*Entry     `| "{" (@@)* "}" ))?`
+
+	Pos lexer.Position
+}
+
+// Condition - A variable, compared to a value with == or !=, or on its own to check that it's set
+type Condition struct {
+	Name     string  `@Ident`
+	Operator string  `( @("==" | "!=")`
+	Value    *string `@(String|Int|Float|Boolean) )?`
 
 	Pos lexer.Position
 }
@@ -60,6 +91,9 @@ type Section struct {
 	Fields []*Field      `(@@)*`
 
 	Pos lexer.Position
+
+	includes []lexer.Position
+	scope    *includeScope
 }
 
 type SectionRoot struct {
@@ -77,15 +111,19 @@ type SectionChild struct {
 }
 
 type Field struct {
-	Key   string      `( (@Ident|@String) ` // Key
-	Child *ChildField `	( "." @@`           // When a child field should be created this is where it goes
-	Value *Value      `	| ":" @@ )?)`       // ? == allow empty values
+	Include     *Include     `( @@ | `             // Includes inside sections are parsed as fields
+	Conditional *Conditional `@@ | `               // As are conditionals inside sections and maps
+	Key         string       `( (@Ident|@String) ` // Key
+	Child       *ChildField  `	( "." @@`           // When a child field should be created this is where it goes
+	Value       *Value       `	| ":" @@ )?))`      // ? == allow empty values
 
 	ArrayIndex *int64
 	// ArrayIndex is not populated at parse-time,
 	// it's in this struct as childfields later get expanded to regular fields
 
 	Pos lexer.Position
+
+	source fieldSource
 }
 
 type ChildField struct {
@@ -108,73 +146,81 @@ type Bool bool
 func (b *Bool) Capture(v []string) error { *b = v[0] == "true"; return nil }
 
 type Value struct {
-	String          *string            `@String`
+	String          *string            `( @String`
 	MultilineString *UnprocessedString `| @@`
 	Integer         *int64             `| @Int`
 	Float           *float64           `| @Float`
 	Boolean         *Bool              `| (@"true" | @"false") `
-	Map             []*Field           `| "{" ((@@ ","?)* )? "}"`
-	ParsedArray     []*Value           `| "[" ((@@ ","?)* )? "]"`
+	Null            bool               `| @"null"`
+	HasMap          bool               `| @"{"` // Set for maps written in braces, so {} isn't mistaken for null
+	Map             []*Field           `((@@ ","?)* )? "}"`
+	HasArray        bool               `| ( @SectionEnd | @"["` // Set for arrays written in brackets, so [] isn't mistaken for {}
+	ParsedArray     []*Value           `((@@ ","?)* )? "]" )`
+	Env             *EnvValue          `| @@`
 	Identifier      *string            `| @Ident @("." Ident)*`
+	Group           *Value             `| "(" @@ ")" )`
+	Operations      []*Operation       `(@@)*` // Operators and the values following them, as in workers + 4
 
 	// Here is where a sequential-number named map goes
 	FinalArray []*Value
 
 	Pos lexer.Position
+
+	// literal is set for strings that are used as they are, without resolving ${...} references
+	literal bool
 }
 
-func checkFileError(err error, filename string) {
-	if err != nil {
-		panic(strings.Replace(err.Error(), "<source>", filename, 1))
-	}
+// Operation - An operator and its right hand operand in an expression. The operand holds the rest
+// of the expression, so operator precedence is only applied when evaluating it
+type Operation struct {
+	Operator string `@("+" | "-" | "*" | "/" | "%")`
+	Operand  *Value `@@`
+
+	Pos lexer.Position
 }
 
-var _workingDirectory string
+// EnvValue - A value read from an environment variable, as in env("NAME") or env("NAME", "default")
+type EnvValue struct {
+	Name    string  `"env" "(" @String`
+	Default *string `("," @String)? ")"`
 
-func setWorkingDirectory(workingDirectory string) {
-	_workingDirectory = workingDirectory
+	Pos lexer.Position
 }
 
 // BuildParser - Builds a new parser with GoFigureLexer as lexer
-func BuildParser() (parser *participle.Parser) {
-	parser, err := participle.Build(
+func BuildParser() (*participle.Parser, error) {
+	return participle.Build(
 		&FigureConfig{},
 		participle.Lexer(GoFigureLexer),
 		participle.Unquote("String"),
 	)
-
-	check(err)
-
-	return
 }
 
-var fileCache map[string]FigureConfig
-
 // ParseFile - Parses a file with given filename and parser. If a nil argument is passed instead of a parser a new one is built
-func ParseFile(filename string, parser *participle.Parser) (config FigureConfig) {
-	if config, exists := fileCache[filename]; exists {
-		return config
-	}
-
+func ParseFile(filename string, parser *participle.Parser) (config FigureConfig, err error) {
 	config = FigureConfig{}
 	if parser == nil {
-		parser = BuildParser()
-	}
+		parser, err = BuildParser()
 
-	if _workingDirectory != "" {
-		filename = _workingDirectory + "/" + filename
+		if err != nil {
+			return
+		}
 	}
 
 	// Open a handle to file
 	file, err := os.Open(filename)
 
-	check(err)
+	if err != nil {
+		return
+	}
 
 	err = parser.Parse(file, &config)
 
-	check(file.Close())
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
 
-	checkFileError(err, filename)
+	err = checkFileError(err, filename)
 
 	return
 }
@@ -1,33 +1,13 @@
-package main
+package gofigure
 
 import (
 	"errors"
 	"regexp"
 	"strconv"
 	"strings"
-)
-
-func lookupIdentifierInRoot(multiKeyName *string) (interface{}, error) {
-	keyNames := strings.Split(*multiKeyName, ".")
-
-	var currRoot interface{}
-	currRoot = globalRoot
-	for i, keyName := range keyNames {
-		switch currRoot.(type) {
-		case map[string]interface{}:
-			if _, exists := currRoot.(map[string]interface{})[keyName]; !exists {
-				return nil, errors.New("No key with the name \"" + keyName + "\" exists. From query: \"" + *multiKeyName + "\"")
-			}
-
-			currRoot = currRoot.(map[string]interface{})[keyName]
-			break
-		default:
-			return nil, errors.New("Key with the name \"" + keyNames[i] + "\" is not a map. From query: \"" + *multiKeyName + "\"")
-		}
-	}
 
-	return currRoot, nil
-}
+	"github.com/alecthomas/participle/lexer"
+)
 
 func (e *Entry) getFileName() string {
 	return e.Pos.Filename
@@ -49,6 +29,16 @@ func (f *Field) getColumn() int {
 	return f.Pos.Column
 }
 
+func (i *Include) getFileName() string {
+	return i.Pos.Filename
+}
+func (i *Include) getLine() int {
+	return i.Pos.Line
+}
+func (i *Include) getColumn() int {
+	return i.Pos.Column
+}
+
 func (v *Value) getFileName() string {
 	return v.Pos.Filename
 }
@@ -65,59 +55,26 @@ type GofigureEntry interface {
 	getColumn() int
 }
 
-func checkConfigError(err error, v GofigureEntry) {
-	if err != nil {
-		panic(err.Error() + " in " + v.getFileName() + ":" + strconv.FormatInt(int64(v.getLine()), 10) + ":" + strconv.FormatInt(int64(v.getColumn()), 10))
-	}
-}
-
-var currPrefix string
-
-func reverseIdentifiers(v *interface{}) {
-	switch (*v).(type) {
-	case map[string]interface{}:
-		for key, value := range (*v).(map[string]interface{}) {
-			currPrefixAddition := "." + key
-
-			currPrefix += currPrefixAddition
-
-			reverseIdentifiers(&value)
-
-			currPrefix = string(currPrefix[:len(currPrefix)-len(currPrefixAddition)])
-		}
-
-		break
-	case []interface{}:
-		for _, element := range (*v).([]interface{}) {
-			reverseIdentifiers(&element)
-		}
-
-		break
-	case identifier:
-		val, err := lookupIdentifierInRoot((*v).(identifier).name)
-
-		check(err)
-
-		*v = val
-		break
-	}
-}
-
 type identifier struct {
 	name *string
 }
 
-func (v *Value) toFinalValue() (ret interface{}) {
+// toFinalValue - Turns v into the value it has in a transformed configuration. A value with
+// nothing set, such as that of a section root without any fields, is an empty map, while
+// bare keys and null are nil
+func (v *Value) toFinalValue(positions positionTable) (ret interface{}) {
 	if v.Identifier != nil {
 		ret = &identifier{v.Identifier}
-	} else if v.Map != nil {
-		nwMap := map[string]interface{}{}
+	} else if v.Null {
+		return nil
+	} else if v.Map != nil || v.HasMap {
+		nwMap := NewOrderedMap()
 
 		for _, field := range v.Map {
 			if field.Value == nil {
-				nwMap[field.Key] = nil
+				nwMap.define(field.Key, nil, field.origins())
 			} else {
-				nwMap[field.Key] = field.Value.toFinalValue()
+				nwMap.define(field.Key, field.Value.toFinalValue(positions), field.origins())
 			}
 		}
 
@@ -128,78 +85,151 @@ func (v *Value) toFinalValue() (ret interface{}) {
 		ret = v.Integer
 	} else if v.Boolean != nil {
 		ret = v.Boolean
-	} else if v.String != nil {
+	} else if v.String != nil && v.literal {
 		ret = v.String
+	} else if v.String != nil {
+		str := unescapeInterpolation(*v.String)
+		ret = &str
 	} else if v.MultilineString != nil {
-		ret = v.MultilineString.transform()
+		ret = unescapeInterpolation(v.MultilineString.transform())
 	} else if v.FinalArray != nil {
 		nwArray := make([]interface{}, len(v.FinalArray), len(v.FinalArray))
 
 		for i, value := range v.FinalArray {
 			if value != nil {
-				nwArray[i] = value.toFinalValue()
+				nwArray[i] = value.toFinalValue(positions)
 			}
 		}
 
 		ret = nwArray
-	} else if v.ParsedArray != nil {
+	} else if v.ParsedArray != nil || v.HasArray {
 		nwArray := make([]interface{}, len(v.ParsedArray), len(v.ParsedArray))
 
 		for i, value := range v.ParsedArray {
 			if value != nil {
-				nwArray[i] = value.toFinalValue()
+				nwArray[i] = value.toFinalValue(positions)
 			}
 		}
 
 		ret = nwArray
-	} else { // Has to be empty map
-		// todo: include flag for omitting empty values?
-		ret = map[string]interface{}{}
+	} else { // Has to be an expression that couldn't be evaluated, which is already reported
+		ret = nil
 	}
 
+	positions.record(ret, v.Pos)
+
 	return
 }
 
-func mergeMapsOfInterface(dst, src map[string]interface{}) {
-	for key, val := range src {
+func mergeMapsOfInterface(dst, src *OrderedMap, positions positionTable) error {
+	for _, key := range src.keys {
+		val := src.values[key]
+
 		// Child level select all roots
 		if key == "@" {
-			for _, root := range dst {
-				switch root.(type) {
-				case map[string]interface{}:
-					mergeMapsOfInterface(root.(map[string]interface{}), val.(map[string]interface{}))
-					break
-				default:
-					// Nothing?
-				}
+			valMap, isMap := val.(*OrderedMap)
+
+			if !isMap {
+				return errors.New("Value selected by \"@\" has to be a map")
+			}
+
+			if err := mergeIntoRoots(dst, valMap, src.origins[key], positions); err != nil {
+				return err
 			}
 
 			continue
 		}
 
-		if _, exists := dst[key]; !exists {
-			dst[key] = val
+		dst.addOrigins(key, src.origins[key])
+
+		dstVal, exists := dst.Get(key)
+
+		if !exists {
+			dst.Set(key, val)
 			continue
 		}
 
-		switch src[key].(type) {
-		case map[string]interface{}:
-			switch dst[key].(type) {
-			case map[string]interface{}:
-				mergeMapsOfInterface(dst[key].(map[string]interface{}), src[key].(map[string]interface{}))
+		switch val.(type) {
+		case *OrderedMap:
+			switch dstVal.(type) {
+			case *OrderedMap:
+				if err := mergeMapsOfInterface(dstVal.(*OrderedMap), val.(*OrderedMap), positions); err != nil {
+					return err
+				}
 
 				break
 
 			default:
-				dst[key] = val
+				dst.Set(key, val)
 			}
 
 			break
 
 		default:
-			dst[key] = val
+			dst.Set(key, val)
+		}
+	}
+
+	return nil
+}
+
+// mergeIntoRoots - Merges src, selected by "@", into every map in dst. Each root gets its own
+// copy of src, so changing one of them later doesn't change the others
+func mergeIntoRoots(dst, src *OrderedMap, origins []Origin, positions positionTable) error {
+	for _, rootKey := range dst.keys {
+		root, isMap := dst.values[rootKey].(*OrderedMap)
+
+		if !isMap {
+			continue
+		}
+
+		dst.addOrigins(rootKey, origins)
+
+		if err := mergeMapsOfInterface(root, cloneValue(src, positions).(*OrderedMap), positions); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cloneValue - Copies the maps and arrays of a transformed value, keeping their positions
+func cloneValue(value interface{}, positions positionTable) (ret interface{}) {
+	switch value.(type) {
+	case *OrderedMap:
+		valueMap := value.(*OrderedMap)
+		clone := &OrderedMap{
+			keys:    append([]string{}, valueMap.keys...),
+			values:  make(map[string]interface{}, len(valueMap.values)),
+			origins: make(map[string][]Origin, len(valueMap.origins)),
+		}
+
+		for key, mapVal := range valueMap.values {
+			clone.values[key] = cloneValue(mapVal, positions)
 		}
+
+		for key, origins := range valueMap.origins {
+			clone.origins[key] = append([]Origin{}, origins...)
+		}
+
+		ret = clone
+	case []interface{}:
+		clone := make([]interface{}, len(value.([]interface{})))
+
+		for i, listVal := range value.([]interface{}) {
+			clone[i] = cloneValue(listVal, positions)
+		}
+
+		ret = clone
+	default:
+		return value
 	}
+
+	if pos, exists := positions.lookup(value); exists {
+		positions.record(ret, pos)
+	}
+
+	return
 }
 
 func findIdentifierInMap(identifier *string, fields []*Field) (*Value, error) {
@@ -220,6 +250,10 @@ func findIdentifierInConfig(identifier *string, root *FigureConfig) (*Value, err
 
 	for _, entry := range root.Entries {
 		field := entry.Field
+		if field == nil {
+			continue
+		}
+
 		value := field.Value
 
 		if len(identParts) == 1 {
@@ -248,47 +282,143 @@ func findIdentifierInConfig(identifier *string, root *FigureConfig) (*Value, err
 		}
 	}
 
+	if err == nil {
+		err = errors.New("No key called " + *identifier + " exists.")
+	}
+
 	return nil, err
 }
 
-func reverseIdentifiersInList(values []*Value, root *FigureConfig) {
+// includeScope - The parameters an include passes to the files it includes. Identifiers in those
+// files are looked up among the parameters first, then among those of the includes further out
+type includeScope struct {
+	params []*Field
+	parent *includeScope
+
+	// resolved is set once the identifiers of the parameters themselves have been resolved
+	resolved bool
+}
+
+// linkScope - Returns inner, the scope of an entry, nested in outer
+func linkScope(inner, outer *includeScope) *includeScope {
+	if inner == nil {
+		return outer
+	}
+
+	outermost := inner
+	for outermost.parent != nil {
+		outermost = outermost.parent
+	}
+
+	if outermost != outer {
+		outermost.parent = outer
+	}
+
+	return inner
+}
+
+// findIdentifier - Looks identifier up among the parameters of the scope and those of its parents,
+// and then in root
+func (s *includeScope) findIdentifier(identifier *string, root *FigureConfig, errs *errorCollector) (*Value, error) {
+	if s == nil {
+		return findIdentifierInConfig(identifier, root)
+	}
+
+	// Parameters may refer to keys and parameters visible to the include passing them
+	if !s.resolved {
+		s.resolved = true
+
+		for _, param := range s.params {
+			param.source.scope = s.parent
+		}
+
+		reverseIdentifiersInMap(s.params, root, "", errs)
+	}
+
+	params := &FigureConfig{Entries: make([]*Entry, len(s.params))}
+
+	for i, param := range s.params {
+		params.Entries[i] = &Entry{Field: param}
+	}
+
+	if value, err := findIdentifierInConfig(identifier, params); err == nil {
+		return value, nil
+	}
+
+	return s.parent.findIdentifier(identifier, root, errs)
+}
+
+func reverseIdentifiersInList(values []*Value, root *FigureConfig, scope *includeScope, path string, errs *errorCollector) {
 	for i, value := range values {
-		if value.Map != nil {
-			reverseIdentifiersInMap(value.Map, root)
+		if errs.full() {
+			return
+		}
+
+		if value == nil {
+			continue
+		}
+
+		valuePath := path + "." + strconv.Itoa(i)
+
+		if value.isExpression() {
+			values[i] = evaluateExpression(value, root, scope, valuePath, errs)
+		} else if value.Map != nil {
+			reverseIdentifiersInMap(value.Map, root, valuePath, errs)
 		} else if value.ParsedArray != nil {
-			reverseIdentifiersInList(value.ParsedArray, root)
+			reverseIdentifiersInList(value.ParsedArray, root, scope, valuePath, errs)
 		} else if value.Identifier != nil {
-			identVal, err := findIdentifierInConfig(value.Identifier, root)
-			checkConfigError(err, value)
+			identVal, err := scope.findIdentifier(value.Identifier, root, errs)
+			errs.add(checkConfigError(UnresolvedIdentifier, err, value, valuePath))
 
 			values[i] = identVal
+		} else if value.String != nil && !value.literal {
+			values[i] = interpolateValue(value, root, scope, valuePath, errs)
 		}
 	}
 }
 
-func reverseIdentifiersInMap(fields []*Field, root *FigureConfig) {
+func reverseIdentifiersInMap(fields []*Field, root *FigureConfig, path string, errs *errorCollector) {
 	for _, field := range fields {
+		if errs.full() {
+			return
+		}
+
+		if field.Include != nil {
+			errs.add(checkConfigError(SyntaxError, errors.New("Includes are only allowed at the top level and in sections"), field.Include, path))
+			continue
+		}
+
 		val := field.Value
 
 		if val == nil {
 			continue
 		}
 
-		if val.Map != nil {
-			reverseIdentifiersInMap(val.Map, root)
+		fieldPath := joinPath(path, field.Key)
+
+		if val.isExpression() {
+			field.Value = evaluateExpression(val, root, field.source.scope, fieldPath, errs)
+		} else if val.Map != nil {
+			reverseIdentifiersInMap(val.Map, root, fieldPath, errs)
 		} else if val.ParsedArray != nil {
-			reverseIdentifiersInList(val.ParsedArray, root)
+			reverseIdentifiersInList(val.ParsedArray, root, field.source.scope, fieldPath, errs)
 		} else if val.Identifier != nil {
-			identVal, err := findIdentifierInConfig(val.Identifier, root)
-			checkConfigError(err, field)
+			identVal, err := field.source.scope.findIdentifier(val.Identifier, root, errs)
+			errs.add(checkConfigError(UnresolvedIdentifier, err, field, fieldPath))
 
 			field.Value = identVal
+		} else if val.String != nil && !val.literal {
+			field.Value = interpolateValue(val, root, field.source.scope, fieldPath, errs)
 		}
 	}
 }
 
-func (c FigureConfig) reverseIdentifiers() {
+func (c FigureConfig) reverseIdentifiers(errs *errorCollector) {
 	for i, entry := range c.Entries {
+		if errs.full() {
+			return
+		}
+
 		field := entry.Field
 
 		if field.Value == nil {
@@ -298,21 +428,25 @@ func (c FigureConfig) reverseIdentifiers() {
 		// Only look at entries up until this point when searching for identifiers
 		tmpConfig := &FigureConfig{Entries: c.Entries[:i+1]}
 
-		if field.Value.Map != nil {
-			reverseIdentifiersInMap(field.Value.Map, tmpConfig)
+		if field.Value.isExpression() {
+			field.Value = evaluateExpression(field.Value, tmpConfig, field.source.scope, field.Key, errs)
+		} else if field.Value.Map != nil {
+			reverseIdentifiersInMap(field.Value.Map, tmpConfig, field.Key, errs)
 		} else if field.Value.ParsedArray != nil {
-			reverseIdentifiersInList(field.Value.ParsedArray, tmpConfig)
+			reverseIdentifiersInList(field.Value.ParsedArray, tmpConfig, field.source.scope, field.Key, errs)
 		} else if field.Value.Identifier != nil {
-			identVal, err := findIdentifierInConfig(field.Value.Identifier, tmpConfig)
-			check(err)
+			identVal, err := field.source.scope.findIdentifier(field.Value.Identifier, tmpConfig, errs)
+			errs.add(checkConfigError(UnresolvedIdentifier, err, field, field.Key))
 
 			field.Value = identVal
+		} else if field.Value.String != nil && !field.Value.literal {
+			field.Value = interpolateValue(field.Value, tmpConfig, field.source.scope, field.Key, errs)
 		}
 	}
 }
 
 func mergeValues(dom, sub *Value) *Value {
-	newValue := &Value{Pos: dom.Pos}
+	newValue := &Value{HasMap: true, Pos: dom.Pos}
 	if dom.Map != nil && sub.Map != nil {
 		newMap := []*Field{}
 		for _, subDominant := range sub.Map {
@@ -327,7 +461,11 @@ func mergeValues(dom, sub *Value) *Value {
 			if foundField == nil {
 				newMap = append(newMap, subDominant)
 			} else {
-				newMap = append(newMap, foundField)
+				// Keep the origins of the replaced field before those of the one replacing it
+				replacing := *foundField
+				replacing.source.chain = append(subDominant.origins(), foundField.origins()...)
+
+				newMap = append(newMap, &replacing)
 			}
 		}
 
@@ -353,39 +491,54 @@ func mergeValues(dom, sub *Value) *Value {
 	return newValue
 }
 
-func (v Value) mergeArraysWithConfig(prefix string, config *FigureConfig) *Value {
-	newValue := &Value{Pos: v.Pos}
+func (v Value) mergeArraysWithConfig(prefix string, config *FigureConfig) (*Value, error) {
+	newValue := &Value{HasMap: v.HasMap, Pos: v.Pos}
 	if v.Map != nil {
 		newMap := make([]*Field, len(v.Map))
 		for i, mapVal := range v.Map {
-			newMap[i] = mapVal.mergeArraysWithConfig(prefix, config)
+			newMapVal, err := mapVal.mergeArraysWithConfig(prefix, config)
+			if err != nil {
+				return nil, err
+			}
+			newMap[i] = newMapVal
 		}
 		newValue.Map = newMap
 	}
 
-	return newValue
+	return newValue, nil
 }
 
-func (f Field) mergeArraysWithConfig(prefix string, config *FigureConfig) *Field {
+func (f Field) mergeArraysWithConfig(prefix string, config *FigureConfig) (*Field, error) {
 	if f.ArrayIndex != nil {
 		val, err := findIdentifierInConfig(&prefix, config)
-		check(err)
+
+		index := strconv.Itoa(int(*f.ArrayIndex))
+
+		if err != nil {
+			return nil, checkConfigError(UnresolvedIdentifier, err, &f, prefix+"."+index)
+		}
+
+		// Bare keys have no value to index into
+		if val == nil {
+			return nil, checkConfigError(TypeConflict, errors.New("Cannot index into \""+prefix+"\", it has no value"), &f, prefix+"."+index)
+		}
 
 		var foundField *Field
 
 		for _, mapVal := range val.Map {
-			if mapVal.Key == strconv.Itoa(int(*f.ArrayIndex)) {
+			if mapVal.Key == index {
 				foundField = mapVal
 				break
 			}
 		}
 
 		if foundField == nil {
-			panic("lol")
+			return nil, checkConfigError(UnresolvedIdentifier, errors.New("No element with index "+index+" exists in \""+prefix+"\""), &f, prefix+"."+index)
 		}
 
 		foundField.Value = mergeValues(f.Value, foundField.Value)
-		return nil
+		foundField.source.chain = append(foundField.origins(), f.origins()...)
+		return nil, nil
 	} else if f.Value != nil {
 		var newPrefix string
 		if prefix == "" {
@@ -394,13 +547,13 @@ func (f Field) mergeArraysWithConfig(prefix string, config *FigureConfig) *Field
 			newPrefix = prefix + "." + f.Key
 		}
 
-		newValue := &Value{Pos: f.Value.Pos}
+		newValue := &Value{HasMap: f.Value.HasMap, Pos: f.Value.Pos}
 		if f.Value.Map != nil {
 			newValue.Map = make([]*Field, len(f.Value.Map))
 			for i, mapVal := range f.Value.Map {
-				newMapVal := mapVal.mergeArraysWithConfig(newPrefix, config)
+				newMapVal, err := mapVal.mergeArraysWithConfig(newPrefix, config)
 				if newMapVal == nil {
-					return nil
+					return nil, err
 				}
 				newValue.Map[i] = newMapVal
 			}
@@ -408,26 +561,30 @@ func (f Field) mergeArraysWithConfig(prefix string, config *FigureConfig) *Field
 			newValue = f.Value
 		}
 
-		return &Field{Pos: f.Pos, Value: newValue, Key: f.Key}
+		return &Field{Pos: f.Pos, Value: newValue, Key: f.Key, source: f.source}, nil
 	}
 
-	return &f
+	return &f, nil
 }
 
-func (e Entry) mergeArraysWithConfig(config *FigureConfig) *Entry {
-	newField := e.Field.mergeArraysWithConfig("", config)
+func (e Entry) mergeArraysWithConfig(config *FigureConfig) (*Entry, error) {
+	newField, err := e.Field.mergeArraysWithConfig("", config)
 	if newField == nil {
-		return nil
+		return nil, err
 	}
 
-	return &Entry{Pos: e.Pos, Field: newField}
+	return &Entry{Pos: e.Pos, Field: newField}, nil
 }
 
-func (c FigureConfig) mergeArrays() (ret FigureConfig) {
+func (c FigureConfig) mergeArrays(errs *errorCollector) (ret FigureConfig) {
 	ret = FigureConfig{Entries: make([]*Entry, 0)}
 
 	for _, entry := range c.Entries {
-		newEntry := entry.mergeArraysWithConfig(&ret)
+		newEntry, err := entry.mergeArraysWithConfig(&ret)
+		if errs.add(checkConfigError(UnresolvedIdentifier, err, entry, entry.Field.Key)) {
+			return
+		}
+
 		if newEntry == nil {
 			continue
 		}
@@ -439,11 +596,12 @@ func (c FigureConfig) mergeArrays() (ret FigureConfig) {
 
 func (f *Field) sequentialFieldsToArrays() *Field {
 	newField := &Field{
-		Pos: f.Pos,
+		Pos:    f.Pos,
+		source: f.source,
 	}
 
 	if f.Value != nil && f.Value.Map != nil {
-		newField.Value = &Value{Pos: f.Value.Pos}
+		newField.Value = &Value{HasMap: true, Pos: f.Value.Pos}
 		newField.Value.Map = make([]*Field, len(f.Value.Map), len(f.Value.Map))
 
 		for i, mapVal := range f.Value.Map {
@@ -459,7 +617,7 @@ func (f *Field) sequentialFieldsToArrays() *Field {
 				newField.Value.FinalArray[index] = mapVal.Value
 			}
 
-			newField.Value.Map = nil
+			newField.Value.Map, newField.Value.HasMap = nil, false
 		}
 	} else {
 		newField.Value = f.Value
@@ -491,21 +649,16 @@ func (c FigureConfig) sequentialFieldsToArrays() (ret FigureConfig) {
 	return
 }
 
-// Transform - Takes a parsed and lexed config file and transforms it to a map
-func (c FigureConfig) Transform() map[string]interface{} {
-	c = c.parseIncludesAndAppendToConfig()
-	c = c.explodeSectionsToFields()
-	c = c.childFieldsToMap()
-
-	c.reverseIdentifiers()
-
-	c = c.fieldsToArrays()
-	c = c.mergeArrays()
-	c = c.sequentialFieldsToArrays()
-
-	mapped := c.toMap()
+// Transform - Takes a parsed and lexed config file and transforms it to a map.
+// Includes are resolved relative to the file it was parsed from and errors are
+// collected up to DefaultMaxErrors and returned together as an ErrorList
+func (c FigureConfig) Transform() (*OrderedMap, error) {
+	return NewLoader().Transform(c)
+}
 
-	return mapped
+// TransformMaxErrors - Like Transform, but gives up after maxErrors errors. A maxErrors below 1 means no limit
+func (c FigureConfig) TransformMaxErrors(maxErrors int) (*OrderedMap, error) {
+	return (&Loader{MaxErrors: maxErrors}).Transform(c)
 }
 
 func keysAreSequential(arg []*Field) bool {
@@ -538,7 +691,7 @@ func getLargestKey(arg []*Field) int {
 }
 
 func (value *Value) fieldsToArrays() (ret *Value) {
-	ret = &Value{Pos: value.Pos}
+	ret = &Value{HasMap: value.HasMap, Pos: value.Pos}
 
 	if value.Map != nil {
 		newMap := make([]*Field, len(value.Map))
@@ -559,7 +712,7 @@ func (field *Field) fieldsToArrays() (ret *Field) {
 		return field
 	}
 
-	ret = &Field{Pos: field.Pos}
+	ret = &Field{Pos: field.Pos, source: field.source}
 	ret.Key = field.Key
 	ret.ArrayIndex = field.ArrayIndex
 	ret.Value = field.Value.fieldsToArrays()
@@ -584,11 +737,8 @@ func (config FigureConfig) fieldsToArrays() (ret FigureConfig) {
 	return
 }
 
-var globalRoot map[string]interface{}
-
-func (c FigureConfig) toMap() (ret map[string]interface{}) {
-	ret = map[string]interface{}{}
-	globalRoot = ret
+func (c FigureConfig) toMap(errs *errorCollector, positions positionTable) (ret *OrderedMap) {
+	ret = NewOrderedMap()
 
 	for _, entry := range c.Entries {
 		field := entry.Field
@@ -597,26 +747,23 @@ func (c FigureConfig) toMap() (ret map[string]interface{}) {
 		var finalValue interface{}
 
 		if value != nil {
-			finalValue = value.toFinalValue()
+			finalValue = value.toFinalValue(positions)
 		}
 
 		// Top level selection of all roots
 		if field.Key == "@" {
-			var processRoots []map[string]interface{}
-
-			for _, val := range ret {
-				switch val.(type) {
-				case map[string]interface{}:
-					processRoots = append(processRoots, val.(map[string]interface{}))
-					break
+			finalMap, isMap := finalValue.(*OrderedMap)
 
-				default:
-					// do nothing?
+			if !isMap {
+				if errs.add(checkConfigError(TypeConflict, errors.New("Value selected by \"@\" has to be a map"), field, field.Key)) {
+					return
 				}
+
+				continue
 			}
 
-			for _, root := range processRoots {
-				mergeMapsOfInterface(root, finalValue.(map[string]interface{}))
+			if errs.add(checkConfigError(TypeConflict, mergeIntoRoots(ret, finalMap, field.origins(), positions), field, field.Key)) {
+				return
 			}
 
 			continue
@@ -624,23 +771,14 @@ func (c FigureConfig) toMap() (ret map[string]interface{}) {
 
 		// Otherwise regular value
 		if value != nil {
-			if _, exists := ret[field.Key]; !exists {
-				ret[field.Key] = finalValue
-			} else {
-				switch finalValue.(type) {
-				case map[string]interface{}:
-					mergeMapsOfInterface(ret[field.Key].(map[string]interface{}), finalValue.(map[string]interface{}))
-					break
-				default: // finalValue is an array?
-					currField := ret[field.Key]
-					for _, arrayVal := range finalValue.([]interface{}) {
-						currField = append(currField.([]Value), arrayVal.(Value))
-					}
-					break
-				}
+			fieldMap := NewOrderedMap()
+			fieldMap.define(field.Key, finalValue, field.origins())
+
+			if errs.add(checkConfigError(TypeConflict, mergeMapsOfInterface(ret, fieldMap, positions), field, field.Key)) {
+				return
 			}
 		} else {
-			ret[field.Key] = nil
+			ret.define(field.Key, nil, field.origins())
 		}
 	}
 
@@ -652,24 +790,8 @@ func (c FigureConfig) childFieldsToMap() (ret FigureConfig) {
 	ret.Entries = make([]*Entry, len(c.Entries))
 
 	for i, entry := range c.Entries {
-		if entry.Field == nil {
-			ret.Entries[i] = entry
-			continue
-		}
-
-		currField := entry.Field
-		for currField.Child != nil {
-			currField.Value = &Value{
-				Map: []*Field{
-					&Field{
-						ArrayIndex: currField.Child.ArrayIndex,
-						Child:      currField.Child.Child,
-						Key:        currField.Child.Key,
-						Value:      currField.Child.Value,
-						Pos:        currField.Child.Pos,
-					}}}
-			currField.Child = nil
-			currField = currField.Value.Map[0]
+		if entry.Field != nil {
+			entry.Field.childFieldsToMap()
 		}
 
 		ret.Entries[i] = entry
@@ -678,24 +800,65 @@ func (c FigureConfig) childFieldsToMap() (ret FigureConfig) {
 	return
 }
 
-func (s *SectionChild) expandToFields(setTo []*Field) (retVal []*Field) {
+// childFieldsToMap - Expands the child fields of f, and of every field in its value, to maps.
+// Fields nested in f are given the section and includes of f
+func (f *Field) childFieldsToMap() {
+	currField := f
+	for currField.Child != nil {
+		currField.Value = &Value{
+			HasMap: true,
+			Map: []*Field{
+				&Field{
+					ArrayIndex: currField.Child.ArrayIndex,
+					Child:      currField.Child.Child,
+					Key:        currField.Child.Key,
+					Value:      currField.Child.Value,
+					Pos:        currField.Child.Pos,
+					source:     fieldSource{section: f.source.section, includes: f.source.includes, scope: f.source.scope},
+				}}}
+		currField.Child = nil
+		currField = currField.Value.Map[0]
+	}
+
+	if currField.Value != nil {
+		currField.Value.childFieldsToMap(f.source)
+	}
+}
+
+func (v *Value) childFieldsToMap(source fieldSource) {
+	for _, field := range v.Map {
+		field.source.inherit(source)
+		field.childFieldsToMap()
+	}
+
+	for _, value := range v.ParsedArray {
+		if value != nil {
+			value.childFieldsToMap(source)
+		}
+	}
+}
+
+func (s *SectionChild) expandToFields(setTo []*Field, source fieldSource) (retVal []*Field) {
 	var childFields []*Field
 
 	if s.Child != nil {
-		childFields = s.Child.expandToFields(setTo)
+		childFields = s.Child.expandToFields(setTo, source)
 	} else {
 		childFields = setTo
 	}
 
-	// Check for integer range expand macro
-	if len(s.Identifier) == 3 && s.Identifier[1] == "..." {
-		int1, _ := strconv.Atoi(s.Identifier[0])
-		int2, _ := strconv.Atoi(s.Identifier[2])
+	// Check for integer range expand macro. Invalid ranges, already reported by
+	// checkSectionRanges, expand to nothing
+	if s.isRange() {
+		int1, int2, err := s.rangeBounds()
+
+		if err != nil {
+			return nil
+		}
 
-		length := (int2 - int1) + 1
-		newIdentifiers := make([]string, length, length)
+		newIdentifiers := make([]string, int2-int1+1)
 
-		for i, _ := range newIdentifiers {
+		for i := range newIdentifiers {
 			newIdentifiers[i] = strconv.Itoa(int1 + i)
 		}
 
@@ -703,7 +866,7 @@ func (s *SectionChild) expandToFields(setTo []*Field) (retVal []*Field) {
 	}
 
 	for _, sectName := range s.Identifier {
-		newField := &Field{Key: sectName, Value: &Value{Map: childFields}}
+		newField := &Field{Key: sectName, Value: &Value{HasMap: true, Map: childFields, Pos: s.Pos}, Pos: s.Pos, source: source}
 
 		retVal = append(retVal, newField)
 	}
@@ -711,17 +874,59 @@ func (s *SectionChild) expandToFields(setTo []*Field) (retVal []*Field) {
 	return
 }
 
-func (s *SectionRoot) expandToFields(setTo []*Field) (retVal []*Field) {
+func (s *SectionChild) isRange() bool {
+	return len(s.Identifier) == 3 && s.Identifier[1] == "..."
+}
+
+// rangeBounds - Returns the first and last index of an integer range such as %{0...3}
+func (s *SectionChild) rangeBounds() (first, last int, err error) {
+	if first, err = strconv.Atoi(s.Identifier[0]); err != nil {
+		return 0, 0, errors.New("Range start " + s.Identifier[0] + " isn't a valid index")
+	}
+
+	if last, err = strconv.Atoi(s.Identifier[2]); err != nil {
+		return 0, 0, errors.New("Range end " + s.Identifier[2] + " isn't a valid index")
+	}
+
+	if last < first {
+		return 0, 0, errors.New("Range %{" + s.Identifier[0] + "..." + s.Identifier[2] + "} ends before it starts")
+	}
+
+	return first, last, nil
+}
+
+// checkSectionRanges - Reports the integer ranges in section headers that can't be expanded
+func (c FigureConfig) checkSectionRanges(errs *errorCollector) {
+	for _, entry := range c.Entries {
+		if entry.Section == nil {
+			continue
+		}
+
+		for _, root := range entry.Section.Roots {
+			for child := root.Child; child != nil; child = child.Child {
+				if !child.isRange() {
+					continue
+				}
+
+				if _, _, err := child.rangeBounds(); err != nil {
+					errs.add(newPositionedError(SyntaxError, "", child.Pos, err.Error()))
+				}
+			}
+		}
+	}
+}
+
+func (s *SectionRoot) expandToFields(setTo []*Field, source fieldSource) (retVal []*Field) {
 	var childFields []*Field
 
 	hasChildren := s.Child != nil
 
 	if hasChildren {
-		childFields = s.Child.expandToFields(setTo)
+		childFields = s.Child.expandToFields(setTo, source)
 	}
 
 	for _, sectName := range s.Identifier {
-		newField := &Field{Key: sectName, Value: &Value{}}
+		newField := &Field{Key: sectName, Value: &Value{HasMap: true, Pos: s.Pos}, Pos: s.Pos, source: source}
 
 		if !hasChildren {
 			newField.Value.Map = setTo
@@ -735,86 +940,124 @@ func (s *SectionRoot) expandToFields(setTo []*Field) (retVal []*Field) {
 	return
 }
 
-func (s *Section) expandToFields() (retVal []*Field) {
+func (s *Section) expandToFields(header lexer.Position) (retVal []*Field) {
+	source := fieldSource{section: &header, includes: s.includes, scope: s.scope}
+
+	for _, field := range s.Fields {
+		field.source.inherit(source)
+	}
+
 	for _, sectRoot := range s.Roots {
-		retVal = append(retVal, sectRoot.expandToFields(s.Fields)...)
+		retVal = append(retVal, sectRoot.expandToFields(s.Fields, source)...)
 	}
 
 	return
 }
 
-func (c FigureConfig) explodeSectionsToFields() (ret FigureConfig) {
-	ret = FigureConfig{}
-	ret.Entries = make([]*Entry, len(c.Entries))
+// mountEntries - Places the entries of an include under each of prefix. Fields are gathered
+// into sections with prefix as roots and the roots of sections are prefixed, so the entries
+// are expanded to fields like any other section. pos is the position of the include
+func mountEntries(entries []*Entry, prefix []SectionRoot, pos lexer.Position) (ret []*Entry) {
+	var fieldSection *Section
 
-	for i, newEntriesIndex := 0, 0; i < len(c.Entries); i++ {
-		entry := c.Entries[i]
-		if entry.Section == nil {
-			ret.Entries[newEntriesIndex] = entry
-			newEntriesIndex++
+	for _, entry := range entries {
+		if entry.Section != nil {
+			section := *entry.Section
+			section.Roots = mountRoots(section.Roots, prefix)
+
+			ret = append(ret, &Entry{Pos: entry.Pos, Section: &section})
+			fieldSection = nil
 			continue
 		}
 
-		section := entry.Section
-
-		newFields := section.expandToFields()
-		newEntries := make([]*Entry, len(newFields))
+		if entry.Field == nil {
+			continue
+		}
 
-		for i, newField := range newFields {
-			newEntries[i] = &Entry{Field: newField}
+		if fieldSection == nil {
+			fieldSection = &Section{Roots: prefix, Pos: pos, includes: []lexer.Position{pos}}
+			ret = append(ret, &Entry{Pos: pos, Section: fieldSection})
 		}
 
-		firstSlice := ret.Entries[:newEntriesIndex]
-		var lastSlice []*Entry
+		fieldSection.Fields = append(fieldSection.Fields, entry.Field)
+	}
 
-		if newEntriesIndex < len(ret.Entries)-1 {
-			lastSlice = ret.Entries[newEntriesIndex+1:]
-		}
+	return
+}
 
-		ret.Entries = append(firstSlice, newEntries...)
-		ret.Entries = append(ret.Entries, lastSlice...)
+// mountRoots - Returns every root placed under every one of prefix
+func mountRoots(roots, prefix []SectionRoot) (ret []SectionRoot) {
+	for _, prefixRoot := range prefix {
+		for _, root := range roots {
+			mounted := prefixRoot
+			mounted.Child = prefixRoot.Child.withLastChild(&SectionChild{Identifier: root.Identifier, Child: root.Child, Pos: root.Pos})
 
-		newEntriesIndex += len(newEntries)
+			ret = append(ret, mounted)
+		}
 	}
 
 	return
 }
 
-func (c FigureConfig) parseIncludesAndAppendToConfig() (ret FigureConfig) {
-	ret = FigureConfig{Pos: c.Pos}
+// mountPathRoots - Returns each of roots, or a root at the top level when there are none, extended by path
+func mountPathRoots(roots []SectionRoot, path []string, pos lexer.Position) []SectionRoot {
+	pathRoot := SectionRoot{Identifier: []string{path[0]}, Pos: pos}
+
+	for i := len(path) - 1; i > 0; i-- {
+		pathRoot.Child = &SectionChild{Identifier: []string{path[i]}, Child: pathRoot.Child, Pos: pos}
+	}
+
+	if roots == nil {
+		return []SectionRoot{pathRoot}
+	}
+
+	return mountRoots([]SectionRoot{pathRoot}, roots)
+}
+
+// withLastChild - Returns a copy of the chain of children starting at s, with last appended to it
+func (s *SectionChild) withLastChild(last *SectionChild) *SectionChild {
+	if s == nil {
+		return last
+	}
+
+	child := *s
+	child.Child = s.Child.withLastChild(last)
+
+	return &child
+}
+
+func (c FigureConfig) explodeSectionsToFields() (ret FigureConfig) {
+	ret = FigureConfig{}
 	ret.Entries = make([]*Entry, len(c.Entries))
 
 	for i, newEntriesIndex := 0, 0; i < len(c.Entries); i++ {
 		entry := c.Entries[i]
-
-		if entry.Include == nil {
+		if entry.Section == nil {
 			ret.Entries[newEntriesIndex] = entry
 			newEntriesIndex++
 			continue
 		}
 
-		include := entry.Include
-		newConfigList := make([]FigureConfig, len(include.Includes))
+		section := entry.Section
 
-		parser := BuildParser()
+		newFields := section.expandToFields(entry.Pos)
+		newEntries := make([]*Entry, len(newFields))
 
-		// Parse includes
-		for j, includeName := range include.Includes {
-			newConfig := ParseFile(includeName, parser)
+		for i, newField := range newFields {
+			newEntries[i] = &Entry{Field: newField}
+		}
 
-			newConfig = newConfig.parseIncludesAndAppendToConfig()
+		firstSlice := ret.Entries[:newEntriesIndex]
+		var lastSlice []*Entry
 
-			newConfigList[j] = newConfig
+		if newEntriesIndex < len(ret.Entries)-1 {
+			lastSlice = ret.Entries[newEntriesIndex+1:]
 		}
 
-		// Append new entries in main config and remove the include entry
-		for _, newConfig := range newConfigList {
-			newEntryList := append(ret.Entries[:newEntriesIndex], newConfig.Entries...)
-			newEntryList = append(newEntryList, ret.Entries[newEntriesIndex+1:]...)
+		ret.Entries = append(firstSlice, newEntries...)
+		ret.Entries = append(ret.Entries, lastSlice...)
 
-			ret.Entries = newEntryList
-			newEntriesIndex += len(newConfig.Entries)
-		}
+		newEntriesIndex += len(newEntries)
 	}
 
 	return
@@ -0,0 +1,169 @@
+package gofigure
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/alecthomas/participle/lexer"
+)
+
+// Schema - Describes which keys a configuration may and must have. A Schema is usually
+// generated from the Go type a configuration is decoded into with SchemaOf, and can be
+// marshaled to JSON to check configurations without the Go type at hand
+type Schema struct {
+	// Fields lists the keys of a struct. A nil Fields means the value isn't a struct
+	Fields map[string]*Schema `json:"fields,omitempty"`
+
+	// Elem describes the values of a map or the elements of an array
+	Elem *Schema `json:"elem,omitempty"`
+
+	// Required is set for struct fields tagged with the required option, as in `fig:"name,required"`
+	Required bool `json:"required,omitempty"`
+}
+
+// SchemaOf - Generates the schema for decoding into values like v, which may also be a pointer
+// to one. Struct fields follow the same rules as Decode. Types referring to themselves are only
+// expanded once, their nested occurrences accept any value
+func SchemaOf(v interface{}) *Schema {
+	t := reflect.TypeOf(v)
+
+	if t == nil {
+		return &Schema{}
+	}
+
+	return schemaOfType(t, map[reflect.Type]bool{})
+}
+
+func schemaOfType(t reflect.Type, inProgress map[reflect.Type]bool) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	schema := &Schema{}
+
+	// Types decoded from scalars, or expanded further up, accept any value
+	if inProgress[t] || t == durationType || reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return schema
+	}
+
+	inProgress[t] = true
+	defer delete(inProgress, t)
+
+	switch t.Kind() {
+	case reflect.Struct:
+		schema.Fields = map[string]*Schema{}
+
+		for _, field := range structFields(t) {
+			fieldSchema := schemaOfType(t.FieldByIndex(field.index).Type, inProgress)
+			fieldSchema.Required = field.required
+
+			schema.Fields[field.name] = fieldSchema
+		}
+
+	case reflect.Map, reflect.Slice, reflect.Array:
+		schema.Elem = schemaOfType(t.Elem(), inProgress)
+	}
+
+	return schema
+}
+
+// Check - Checks config against the schema and returns an ErrorList of every key the
+// schema doesn't know of and every required key that has no value
+func (s *Schema) Check(config *Config) error {
+	errs := &errorCollector{max: DefaultMaxErrors}
+
+	s.check("", config.root, config.positions, lexer.Position{}, errs)
+
+	return errs.err()
+}
+
+func (s *Schema) check(path string, value interface{}, positions positionTable, pos lexer.Position, errs *errorCollector) {
+	if errs.full() {
+		return
+	}
+
+	if valuePos, exists := positions.lookup(value); exists {
+		pos = valuePos
+	}
+
+	switch value.(type) {
+	case *OrderedMap:
+		valueMap := value.(*OrderedMap)
+
+		if s.Fields != nil {
+			s.checkFields(path, valueMap, positions, pos, errs)
+		} else if s.Elem != nil {
+			for _, key := range valueMap.keys {
+				s.Elem.check(joinPath(path, key), valueMap.values[key], positions, pos, errs)
+			}
+		}
+
+	case []interface{}:
+		if s.Elem != nil {
+			for i, element := range value.([]interface{}) {
+				s.Elem.check(joinPath(path, strconv.Itoa(i)), element, positions, pos, errs)
+			}
+		}
+	}
+}
+
+func (s *Schema) checkFields(path string, value *OrderedMap, positions positionTable, pos lexer.Position, errs *errorCollector) {
+	known := map[string]bool{}
+
+	for _, name := range sortedKeys(s.Fields) {
+		fieldSchema := s.Fields[name]
+		key, exists := findKey(value, name)
+
+		if !exists || value.values[key] == nil {
+			if fieldSchema.Required {
+				errs.add(newPositionedError(MissingKey, joinPath(path, name), pos, "Required key \""+name+"\" has no value"))
+			}
+
+			if !exists {
+				continue
+			}
+		}
+
+		known[key] = true
+
+		fieldSchema.check(joinPath(path, key), value.values[key], positions, pos, errs)
+	}
+
+	for _, key := range value.keys {
+		if known[key] {
+			continue
+		}
+
+		// Values can be shared with the keys they were copied from, so the key's own origin is used
+		keyPos := pos
+		if origins := value.origins[key]; len(origins) > 0 {
+			keyPos = origins[len(origins)-1].Pos
+		}
+
+		errs.add(newPositionedError(UnknownKey, joinPath(path, key), keyPos, "Key \""+key+"\" isn't used"))
+	}
+}
+
+func newPositionedError(kind ErrorKind, path string, pos lexer.Position, message string) *ConfigError {
+	return &ConfigError{
+		Kind:     kind,
+		Filename: pos.Filename,
+		Line:     pos.Line,
+		Column:   pos.Column,
+		KeyPath:  path,
+		Message:  message,
+	}
+}
+
+func sortedKeys(m map[string]*Schema) []string {
+	keys := []string{}
+
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,124 @@
+package gofigure
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type schemaTestBackup struct {
+	Host string `fig:"host"`
+	Port int    `fig:"port"`
+}
+
+type schemaTestServer struct {
+	Host    string              `fig:"host,required"`
+	Port    int                 `fig:"port,required"`
+	Backups []*schemaTestBackup `fig:"backups"`
+	Labels  map[string]string   `fig:"labels"`
+}
+
+type schemaTestConfig struct {
+	Server  schemaTestServer `fig:"server"`
+	Workers int              `fig:"workers"`
+}
+
+func TestStrictDecode(t *testing.T) {
+	config, err := Load(strings.NewReader(`
+	workers: 4
+	wrokers: 8
+
+	[server]
+	hsot: "localhost"
+	port: 8080
+	labels: { any: "label" }
+	backups: [{ host: "backup" port: 8081 timeout: 5 }]`), "test.fig")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded schemaTestConfig
+	if err := Decode(config, &decoded); err != nil {
+		t.Fatalf("Expected a non-strict decode to succeed, got: %v", err)
+	}
+
+	decoder := NewDecoder(config)
+	decoder.Strict = true
+
+	err = decoder.Decode(&decoded)
+
+	errs, isErrorList := err.(ErrorList)
+	if !isErrorList {
+		t.Fatalf("Expected an ErrorList, got: %v", err)
+	}
+
+	expected := []struct {
+		kind    ErrorKind
+		keyPath string
+		line    int
+	}{
+		{UnknownKey, "server.backups.0.timeout", 9},
+		{MissingKey, "server.host", 5},
+		{UnknownKey, "server.hsot", 6},
+		{UnknownKey, "wrokers", 3},
+	}
+
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected %d errors, got: %v", len(expected), err)
+	}
+
+	for i, configErr := range errs {
+		if configErr.Kind != expected[i].kind || configErr.KeyPath != expected[i].keyPath || configErr.Line != expected[i].line {
+			t.Errorf("Got: %s\nExpected: %s at %q on line %d", configErr, expected[i].kind, expected[i].keyPath, expected[i].line)
+		}
+	}
+}
+
+func TestUnknownKeyPositions(t *testing.T) {
+	config, err := Load(strings.NewReader(`workers: 4
+[server]
+host: "localhost"
+port: 8080
+hsot: server.host
+wrokers
+extra: null`), "test.fig")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs, isErrorList := SchemaOf(&schemaTestConfig{}).Check(config).(ErrorList)
+	if !isErrorList || len(errs) != 3 {
+		t.Fatalf("Expected three errors, got: %v", errs)
+	}
+
+	for i, expected := range []struct {
+		keyPath string
+		line    int
+	}{{"server.hsot", 5}, {"server.wrokers", 6}, {"server.extra", 7}} {
+		if errs[i].Kind != UnknownKey || errs[i].KeyPath != expected.keyPath || errs[i].Line != expected.line {
+			t.Errorf("Got: %s\nExpected: UnknownKey at %q on line %d", errs[i], expected.keyPath, expected.line)
+		}
+	}
+}
+
+func TestSchemaSurvivesJSON(t *testing.T) {
+	marshaled, err := json.Marshal(SchemaOf(&schemaTestConfig{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema := &Schema{}
+	if err := json.Unmarshal(marshaled, schema); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := Load(strings.NewReader(`server: { host: "localhost" port: 80 extra: true }`), "test.fig")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs, isErrorList := schema.Check(config).(ErrorList)
+	if !isErrorList || len(errs) != 1 || errs[0].Kind != UnknownKey || errs[0].KeyPath != "server.extra" {
+		t.Errorf("Expected an unknown key error for server.extra, got: %v", errs)
+	}
+}